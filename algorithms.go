@@ -0,0 +1,88 @@
+package ssh_config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// algorithmDirectives are the directives whose value may start with '+', '-'
+// or '^' to append to, remove from or prepend to the default list.
+var algorithmDirectives = []string{
+	"casignaturealgorithms",
+	"ciphers",
+	"hostbasedacceptedalgorithms",
+	"hostkeyalgorithms",
+	"kexalgorithms",
+	"macs",
+	"pubkeyacceptedalgorithms",
+}
+
+// applyAlgorithmModifiers replaces algorithm lists that use a modifier with
+// the effective list, computed against the spec default. In strict mode a
+// list that ends up empty or has a bad pattern is an error; otherwise the
+// value is left unchanged.
+func applyAlgorithmModifiers(state *resolveState, spec *clientSpec, options resolveOptions) error {
+	for _, key := range algorithmDirectives {
+		vals := state.values[key]
+		if len(vals) == 0 || vals[0] == "" || !strings.ContainsRune("+-^", rune(vals[0][0])) {
+			continue
+		}
+		d := spec.byName[key]
+		if d == nil {
+			continue
+		}
+		defaults := d.defaultValues()
+		if len(defaults) == 0 {
+			continue
+		}
+		list, err := assembleAlgorithms(vals[0], defaults[0])
+		if err != nil {
+			if options.strict {
+				return fmt.Errorf("ssh_config: %s: %s: %v", state.origins[key][0], key, err)
+			}
+			continue
+		}
+		vals[0] = list
+	}
+	return nil
+}
+
+// assembleAlgorithms applies the modifier of value to the comma-separated
+// list def, like ssh's kex_assemble_names. Duplicates are dropped, keeping the
+// first occurrence.
+func assembleAlgorithms(value, def string) (string, error) {
+	var items []string
+	switch value[0] {
+	case '+':
+		items = append(splitAlgorithms(def), splitAlgorithms(value[1:])...)
+	case '^':
+		items = append(splitAlgorithms(value[1:]), splitAlgorithms(def)...)
+	case '-':
+		for _, item := range splitAlgorithms(def) {
+			removed, err := matchPatternList(item, value[1:], false)
+			if err != nil {
+				return "", err
+			}
+			if !removed {
+				items = append(items, item)
+			}
+		}
+	default:
+		return value, nil
+	}
+	items = removeDups(items)
+	if len(items) == 0 {
+		return "", fmt.Errorf("%q leaves no algorithms", value)
+	}
+	return strings.Join(items, ","), nil
+}
+
+func splitAlgorithms(list string) []string {
+	var out []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
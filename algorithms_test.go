@@ -0,0 +1,68 @@
+package ssh_config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAssembleAlgorithms(t *testing.T) {
+	const def = "a-ctr,b-gcm@openssh.com,c-ctr"
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"x-cbc,a-ctr", "x-cbc,a-ctr"},
+		{"+x-cbc,a-ctr", "a-ctr,b-gcm@openssh.com,c-ctr,x-cbc"},
+		{"^x-cbc,c-ctr", "x-cbc,c-ctr,a-ctr,b-gcm@openssh.com"},
+		{"-*-ctr", "b-gcm@openssh.com"},
+		{"-b-gcm@openssh.com,nope", "a-ctr,c-ctr"},
+	}
+	for _, tt := range tests {
+		got, err := assembleAlgorithms(tt.value, def)
+		if err != nil {
+			t.Errorf("assembleAlgorithms(%q): %v", tt.value, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("assembleAlgorithms(%q) got %q, want %q", tt.value, got, tt.want)
+		}
+	}
+	if _, err := assembleAlgorithms("-*", def); err == nil {
+		t.Error("expected error when every algorithm is removed")
+	}
+}
+
+func TestResolveAlgorithmModifiers(t *testing.T) {
+	input := "Host *\n  Ciphers +aes128-cbc\n  MACs -*-sha1*,umac-*\n  HostKeyAlgorithms ^ssh-rsa\n  KexAlgorithms curve25519-sha256\n"
+	res := resolveString(t, input, Context{HostArg: "web", LocalUser: "local"})
+
+	ciphers := res.Get("Ciphers")
+	if want := Default("Ciphers") + ",aes128-cbc"; ciphers != want {
+		t.Errorf("Ciphers got %q, want %q", ciphers, want)
+	}
+	macs := res.Get("MACs")
+	if macs != "hmac-sha2-256-etm@openssh.com,hmac-sha2-512-etm@openssh.com,hmac-sha2-256,hmac-sha2-512" {
+		t.Errorf("MACs got %q", macs)
+	}
+	if got := res.Get("HostKeyAlgorithms"); !strings.HasPrefix(got, "ssh-rsa,ssh-ed25519-cert-v01@openssh.com,") {
+		t.Errorf("HostKeyAlgorithms got %q", got)
+	}
+	if got := res.Get("KexAlgorithms"); got != "curve25519-sha256" {
+		t.Errorf("KexAlgorithms got %q", got)
+	}
+
+	cfg, err := Decode(strings.NewReader("Host *\n  Ciphers -*\n"))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	res, err = cfg.Resolve(Context{HostArg: "web"})
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if got := res.Get("Ciphers"); got != "-*" {
+		t.Errorf("Ciphers got %q, want it unchanged", got)
+	}
+	if _, err := cfg.Resolve(Context{HostArg: "web"}, Strict()); err == nil || !strings.Contains(err.Error(), "leaves no algorithms") {
+		t.Errorf("expected empty list error, got %v", err)
+	}
+}
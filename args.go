@@ -0,0 +1,118 @@
+package ssh_config
+
+import (
+	"errors"
+	"strings"
+)
+
+// errInvalidQuotes is returned by argvSplit for an unterminated quote.
+var errInvalidQuotes = errors.New("invalid quotes")
+
+// argvSplit splits s into arguments like OpenSSH's argv_split. Arguments are
+// separated by spaces and tabs and may be quoted with double or single
+// quotes. A backslash escapes a quote, a backslash or, outside quotes, a
+// space; other backslashes are kept. A # that starts an argument begins a
+// comment.
+func argvSplit(s string) ([]string, error) {
+	var args []string
+	for i := 0; i < len(s); i++ {
+		if s[i] == ' ' || s[i] == '\t' {
+			continue
+		}
+		if s[i] == '#' {
+			break
+		}
+		var arg strings.Builder
+		var quote byte
+	token:
+		for ; i < len(s); i++ {
+			c := s[i]
+			switch {
+			case c == '\\' && i+1 < len(s) && isEscapable(s[i+1], quote):
+				i++
+				arg.WriteByte(s[i])
+			case quote == 0 && (c == ' ' || c == '\t'):
+				break token
+			case quote == 0 && (c == '"' || c == '\''):
+				quote = c
+			case quote != 0 && c == quote:
+				quote = 0
+			default:
+				arg.WriteByte(c)
+			}
+		}
+		if quote != 0 {
+			return nil, errInvalidQuotes
+		}
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
+
+func isEscapable(c, quote byte) bool {
+	return c == '\'' || c == '"' || c == '\\' || (quote == 0 && c == ' ')
+}
+
+// quoteArg quotes s, if needed, so that argvSplit reads it back as a single
+// argument.
+func quoteArg(s string) string {
+	if s != "" && s[0] != '#' && !strings.ContainsAny(s, " \t\"'\\") {
+		return s
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// joinArgs quotes args as needed and joins them with spaces.
+func joinArgs(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = quoteArg(arg)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// splitArgs splits s with argvSplit, falling back to whitespace if its
+// quotes are unbalanced.
+func splitArgs(s string) []string {
+	args, err := argvSplit(s)
+	if err != nil {
+		return strings.Fields(s)
+	}
+	return args
+}
+
+// commandDirectives take the rest of the line as written, usually a shell
+// command, which ssh does not split into arguments.
+var commandDirectives = map[string]bool{
+	"knownhostscommand": true,
+	"localcommand":      true,
+	"proxycommand":      true,
+	"remotecommand":     true,
+	"versionaddendum":   true,
+}
+
+// Args returns the arguments of k's value, split and unquoted as ssh does.
+// For example, the value `"/path with space/key"` is a single argument. It
+// fails if the value has an unterminated quote.
+func (k *KV) Args() ([]string, error) {
+	return argvSplit(k.Value)
+}
+
+// directiveValue returns the value that key takes when it is set to value:
+// the value as written for commands and for list and forward directives,
+// which Result.GetList and Unmarshal split again and Result.GetAll unquotes,
+// and the unquoted arguments otherwise.
+func directiveValue(spec *clientSpec, key, value string) (string, error) {
+	lkey := strings.ToLower(key)
+	if commandDirectives[lkey] {
+		return value, nil
+	}
+	args, err := argvSplit(value)
+	if err != nil {
+		return "", err
+	}
+	if d := spec.lookupDirective(lkey); d != nil && (d.Type == "list" || d.Type == "forward") {
+		return value, nil
+	}
+	return strings.Join(args, " "), nil
+}
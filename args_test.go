@@ -0,0 +1,151 @@
+package ssh_config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestArgvSplit(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"", nil},
+		{"a b\tc", []string{"a", "b", "c"}},
+		{`"/path with space/key"`, []string{"/path with space/key"}},
+		{`'single "quoted"' x`, []string{`single "quoted"`, "x"}},
+		{`a\ b`, []string{"a b"}},
+		{`"a \"b\" c"`, []string{`a "b" c`}},
+		{`a\\b \x`, []string{`a\b`, `\x`}},
+		{`"" x`, []string{"", "x"}},
+		{`pre"fix mid"post`, []string{"prefix midpost"}},
+		{"a #comment", []string{"a"}},
+		{"a#b", []string{"a#b"}},
+		{`"#a" b`, []string{"#a", "b"}},
+	}
+	for _, tt := range tests {
+		got, err := argvSplit(tt.in)
+		if err != nil {
+			t.Errorf("argvSplit(%q): %v", tt.in, err)
+			continue
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("argvSplit(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+		if len(tt.want) > 0 {
+			back, err := argvSplit(joinArgs(tt.want))
+			if err != nil || !slices.Equal(back, tt.want) {
+				t.Errorf("argvSplit(joinArgs(%q)) = %q, %v", tt.want, back, err)
+			}
+		}
+	}
+	for _, in := range []string{`"abc`, `a 'b`, `"a\"`} {
+		if _, err := argvSplit(in); err != errInvalidQuotes {
+			t.Errorf("argvSplit(%q): got error %v, want %v", in, err, errInvalidQuotes)
+		}
+	}
+}
+
+func TestKVArgs(t *testing.T) {
+	cfg, err := Decode(strings.NewReader("Host *\n  SendEnv \"LANG LC_*\" 'X Y' # comment\n  User \"a #b\"\n"))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	nodes := cfg.Hosts[1].Nodes
+	args, err := nodes[0].(*KV).Args()
+	if err != nil || !slices.Equal(args, []string{"LANG LC_*", "X Y"}) {
+		t.Errorf("SendEnv Args() = %q, %v", args, err)
+	}
+	args, err = nodes[1].(*KV).Args()
+	if err != nil || !slices.Equal(args, []string{"a #b"}) {
+		t.Errorf("User Args() = %q, %v", args, err)
+	}
+	if _, err := (&KV{Key: "User", Value: `"bob`}).Args(); err == nil {
+		t.Error("expected an error for an unterminated quote")
+	}
+}
+
+func TestResolveQuotedValues(t *testing.T) {
+	dir := t.TempDir()
+	inner := filepath.Join(dir, "a b")
+	if err := os.WriteFile(inner, []byte("Host \"foo bar\"\n  Port 2200\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config := `Include "` + inner + `"
+Host "foo bar" baz
+  IdentityFile "/path with space/key"
+  UserKnownHostsFile "/known hosts" /other
+  SendEnv "A B" C
+  LocalForward 8080 "/run/my app.sock"
+  ProxyCommand ssh -W "%h:%p" jump
+`
+	cfg, err := Decode(strings.NewReader(config))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if got := cfg.String(); got != config {
+		t.Errorf("String() = %q, want %q", got, config)
+	}
+	res, err := cfg.Resolve(Context{HostArg: "foo bar"}, Strict())
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if got := res.Get("Port"); got != "2200" {
+		t.Errorf("Port = %q, want 2200 from the included file", got)
+	}
+	if got := res.Get("IdentityFile"); got != "/path with space/key" {
+		t.Errorf("IdentityFile = %q", got)
+	}
+	files, err := res.GetList("UserKnownHostsFile")
+	if err != nil || !slices.Equal(files, []string{"/known hosts", "/other"}) {
+		t.Errorf("UserKnownHostsFile = %q, %v", files, err)
+	}
+	if got := res.GetAll("UserKnownHostsFile"); !slices.Equal(got, []string{"/known hosts /other"}) {
+		t.Errorf("GetAll(UserKnownHostsFile) = %q, want the paths unquoted", got)
+	}
+	expanded, err := res.GetAllExpanded("UserKnownHostsFile")
+	if err != nil || !slices.Equal(expanded, []string{"/known hosts /other"}) {
+		t.Errorf("GetAllExpanded(UserKnownHostsFile) = %q, %v", expanded, err)
+	}
+	if got := res.Get("SendEnv"); got != "A B C" {
+		t.Errorf("SendEnv = %q, want A B C", got)
+	}
+	if vars, err := res.GetList("SendEnv"); err != nil || !slices.Equal(vars, []string{"A B", "C"}) {
+		t.Errorf("GetList(SendEnv) = %q, %v", vars, err)
+	}
+	if got := res.Get("LocalForward"); got != "8080 /run/my app.sock" {
+		t.Errorf("LocalForward = %q", got)
+	}
+	opts, err := res.Options()
+	if err != nil || len(opts.LocalForwards) != 1 || opts.LocalForwards[0].Connect.Path != "/run/my app.sock" {
+		t.Errorf("Options().LocalForwards = %+v, %v", opts, err)
+	}
+	if got := res.Get("ProxyCommand"); got != `ssh -W "%h:%p" jump` {
+		t.Errorf("ProxyCommand = %q, want the command as written", got)
+	}
+
+	res, err = cfg.Resolve(Context{HostArg: "foo"})
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if got := res.Get("IdentityFile"); got == "/path with space/key" {
+		t.Error("Host \"foo bar\" should not match foo")
+	}
+}
+
+func TestBadQuotes(t *testing.T) {
+	_, err := Decode(strings.NewReader("Host foo\n  User \"bob\n"))
+	var perr *ParseError
+	if !errors.As(err, &perr) || perr.Kind != KindBadQuotes || perr.Position != (Position{2, 8}) {
+		t.Fatalf("expected a KindBadQuotes error at (2, 8), got %#v", err)
+	}
+
+	// A shell command is not split, so its quotes are not checked.
+	if _, err := Decode(strings.NewReader("ProxyCommand sh -c \"nc %h\n")); err != nil {
+		t.Errorf("Decode: %v", err)
+	}
+}
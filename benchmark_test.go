@@ -52,6 +52,37 @@ func BenchmarkDecodeBytes(b *testing.B) {
 	}
 }
 
+// BenchmarkDecode decodes each config in testdata that parses without
+// errors, to compare lexer and parser allocations between changes.
+func BenchmarkDecode(b *testing.B) {
+	names, err := filepath.Glob(filepath.Join("testdata", "config*"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	var inputs [][]byte
+	for _, name := range names {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := Decode(bytes.NewReader(data)); err == nil {
+			inputs = append(inputs, data)
+		}
+	}
+	if len(inputs) == 0 {
+		b.Fatal("no configs to decode in testdata")
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, data := range inputs {
+			if _, err := Decode(bytes.NewReader(data)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
 func BenchmarkResolve(b *testing.B) {
 	data := loadTestdata(b, "config3")
 	cfg, err := DecodeBytes(data)
@@ -0,0 +1,179 @@
+package ssh_config
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// HostResolver looks up host names for CanonicalizeHostname.
+type HostResolver interface {
+	// LookupHost resolves host, which ends in a dot when it is fully
+	// qualified. It returns the canonical name of host if it is an alias
+	// (CNAME), or an empty string otherwise. An error means host does not
+	// resolve.
+	LookupHost(host string) (canonical string, err error)
+}
+
+// systemResolver resolves host names with the net package.
+type systemResolver struct{}
+
+func (systemResolver) LookupHost(host string) (string, error) {
+	if _, err := net.LookupHost(host); err != nil {
+		return "", err
+	}
+	cname, err := net.LookupCNAME(host)
+	if err != nil {
+		return "", nil
+	}
+	return strings.TrimSuffix(cname, "."), nil
+}
+
+// CanonicalizeHostname enables the built-in host name canonicalization, which
+// follows the CanonicalizeHostname, CanonicalDomains, CanonicalizeMaxDots,
+// CanonicalizeFallbackLocal and CanonicalizePermittedCNAMEs values of the
+// first pass like ssh does. Names are looked up with r, or with the system
+// resolver if r is nil.
+//
+// When CanonicalizeHostname is enabled, Resolve runs a canonical pass, in
+// which Match canonical is true and the canonical name is the host argument,
+// even if the name could not or should not be canonicalized. It replaces a
+// callback set with Canonicalize.
+func CanonicalizeHostname(r HostResolver) ResolveOption {
+	return func(o *resolveOptions) {
+		if r == nil {
+			r = systemResolver{}
+		}
+		o.hostResolver = r
+		o.canonicalize = nil
+	}
+}
+
+// canonicalizeHost returns the canonical name of host according to the
+// canonicalization settings of res. enabled reports whether ssh would run a
+// canonical pass.
+func canonicalizeHost(host string, res *Result, r HostResolver) (canonical string, enabled bool, err error) {
+	mode, err := res.GetEnum("CanonicalizeHostname")
+	if err != nil {
+		return "", false, err
+	}
+	switch mode {
+	case "", "no", "false":
+		return host, false, nil
+	case "true":
+		mode = "yes"
+	}
+	c, err := newCanonicalizer(res, mode)
+	if err != nil {
+		return "", false, err
+	}
+	canonical, found, err := c.canonicalize(host, r)
+	if err != nil {
+		return "", false, err
+	}
+	// Even when canonicalization fails, ssh tries the bare name with the
+	// system search rules so CanonicalizePermittedCNAMEs can apply. ssh
+	// would then fail to connect to a name that does not resolve; here the
+	// name is simply kept.
+	if !found && len(c.cnameRules) > 0 && (c.direct || c.always) {
+		if cname, err := r.LookupHost(host); err == nil {
+			canonical = c.followCNAME(host, cname)
+		}
+	}
+	return canonical, true, nil
+}
+
+// canonicalizer holds the canonicalization settings of a first-pass Result.
+type canonicalizer struct {
+	always        bool
+	direct        bool
+	domains       []string
+	maxDots       uint
+	fallbackLocal bool
+	cnameRules    []string
+}
+
+func newCanonicalizer(res *Result, mode string) (*canonicalizer, error) {
+	c := &canonicalizer{always: mode == "always"}
+	proxy := res.Get("ProxyCommand")
+	jump := res.Get("ProxyJump")
+	c.direct = (proxy == "" || strings.EqualFold(proxy, "none")) && (jump == "" || strings.EqualFold(jump, "none"))
+	var err error
+	if c.domains, err = res.GetList("CanonicalDomains"); err != nil {
+		return nil, err
+	}
+	if c.maxDots, err = res.GetUint("CanonicalizeMaxDots"); err != nil {
+		return nil, err
+	}
+	if c.fallbackLocal, err = res.GetBool("CanonicalizeFallbackLocal"); err != nil {
+		return nil, err
+	}
+	if c.cnameRules, err = res.GetList("CanonicalizePermittedCNAMEs"); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// canonicalize follows ssh's resolve_canonicalize. found reports whether a
+// canonical name was found.
+func (c *canonicalizer) canonicalize(host string, r HostResolver) (canonical string, found bool, err error) {
+	if !c.direct && !c.always {
+		return host, false, nil
+	}
+	if net.ParseIP(host) != nil {
+		return host, false, nil
+	}
+	if strings.HasSuffix(host, ".") {
+		if cname, err := r.LookupHost(host); err == nil {
+			return c.followCNAME(strings.TrimSuffix(host, "."), cname), true, nil
+		}
+		return c.notFound(host)
+	}
+	if uint(strings.Count(host, ".")) > c.maxDots {
+		return host, false, nil
+	}
+	for _, domain := range c.domains {
+		full := host + "." + domain + "."
+		cname, err := r.LookupHost(full)
+		if err != nil {
+			continue
+		}
+		return c.followCNAME(strings.TrimSuffix(full, "."), cname), true, nil
+	}
+	return c.notFound(host)
+}
+
+func (c *canonicalizer) notFound(host string) (string, bool, error) {
+	if !c.fallbackLocal {
+		return "", false, fmt.Errorf("ssh_config: could not resolve host %q", host)
+	}
+	return host, false, nil
+}
+
+// followCNAME returns cname if a CanonicalizePermittedCNAMEs rule allows
+// name to be replaced by it, and name otherwise.
+func (c *canonicalizer) followCNAME(name, cname string) string {
+	cname = strings.TrimSuffix(cname, ".")
+	if cname == "" || strings.EqualFold(name, cname) {
+		return name
+	}
+	if !c.direct && !c.always {
+		return name
+	}
+	for _, rule := range c.cnameRules {
+		source, target, ok := strings.Cut(rule, ":")
+		if !ok {
+			continue
+		}
+		srcOK, err := matchPatternList(name, source, true)
+		if err != nil || !srcOK {
+			continue
+		}
+		dstOK, err := matchPatternList(cname, target, true)
+		if err != nil || !dstOK {
+			continue
+		}
+		return cname
+	}
+	return name
+}
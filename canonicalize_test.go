@@ -0,0 +1,109 @@
+package ssh_config
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// fakeResolver maps the names it knows to their CNAME, or to "" if they are
+// not aliases.
+type fakeResolver struct {
+	names   map[string]string
+	lookups []string
+}
+
+func (f *fakeResolver) LookupHost(host string) (string, error) {
+	f.lookups = append(f.lookups, host)
+	cname, ok := f.names[host]
+	if !ok {
+		return "", errors.New("no such host")
+	}
+	return cname, nil
+}
+
+func TestResolveCanonicalizeHostname(t *testing.T) {
+	const base = `CanonicalDomains a.example.com b.example.com
+CanonicalizePermittedCNAMEs *.b.example.com:*.cdn.example.net
+Match canonical host web.b.example.com
+  User canon-web
+Match canonical host *.cdn.example.net
+  User canon-cdn
+Match canonical
+  Port 2222
+Host proxied
+  ProxyJump bastion
+`
+	names := map[string]string{
+		"web.b.example.com.": "",
+		"api.b.example.com.": "edge.cdn.example.net.",
+		"fqdn.example.org.":  "",
+	}
+	tests := []struct {
+		name    string
+		mode    string
+		host    string
+		user    string
+		port    string
+		lookups int
+	}{
+		{"disabled", "no", "web", "local", "22", 0},
+		{"domain search", "yes", "web", "canon-web", "2222", 2},
+		{"permitted cname", "yes", "api", "canon-cdn", "2222", 2},
+		{"too many dots", "yes", "web.b.c", "local", "2222", 1},
+		{"fallback local", "yes", "nowhere", "local", "2222", 3},
+		{"fully qualified", "yes", "fqdn.example.org.", "local", "2222", 1},
+		{"proxied", "yes", "proxied", "local", "2222", 0},
+		{"proxied always", "always", "proxied", "local", "2222", 3},
+		{"ip address", "yes", "192.0.2.1", "local", "2222", 1},
+	}
+	for _, tt := range tests {
+		cfg, err := Decode(strings.NewReader("CanonicalizeHostname " + tt.mode + "\n" + base))
+		if err != nil {
+			t.Fatalf("Decode: %v", err)
+		}
+		resolver := &fakeResolver{names: names}
+		res, err := cfg.Resolve(Context{HostArg: tt.host, LocalUser: "local"}, CanonicalizeHostname(resolver))
+		if err != nil {
+			t.Errorf("%s: Resolve: %v", tt.name, err)
+			continue
+		}
+		if got := res.Get("User"); got != tt.user {
+			t.Errorf("%s: User got %q, want %q", tt.name, got, tt.user)
+		}
+		if got := res.Get("Port"); got != tt.port {
+			t.Errorf("%s: Port got %q, want %q", tt.name, got, tt.port)
+		}
+		if len(resolver.lookups) != tt.lookups {
+			t.Errorf("%s: lookups got %q, want %d", tt.name, resolver.lookups, tt.lookups)
+		}
+	}
+}
+
+func TestResolveCanonicalizeFallbackLocalNo(t *testing.T) {
+	input := "CanonicalizeHostname yes\nCanonicalDomains example.com\nCanonicalizeFallbackLocal no\n"
+	cfg, err := Decode(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	_, err = cfg.Resolve(Context{HostArg: "missing"}, CanonicalizeHostname(&fakeResolver{}))
+	if err == nil || !strings.Contains(err.Error(), `could not resolve host "missing"`) {
+		t.Errorf("expected resolve error, got %v", err)
+	}
+}
+
+func TestResolveCanonicalizeHostNameDirective(t *testing.T) {
+	input := "Host db\n  HostName db-1\nHost *\n  CanonicalizeHostname yes\n  CanonicalDomains example.com\nMatch canonical host db-1.example.com\n  User db-user\n"
+	cfg, err := Decode(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	resolver := &fakeResolver{names: map[string]string{"db-1.example.com.": ""}}
+	res, err := cfg.Resolve(Context{HostArg: "db", LocalUser: "local"}, CanonicalizeHostname(resolver))
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if got := res.Get("User"); got != "db-user" {
+		t.Errorf("User got %q, want db-user", got)
+	}
+}
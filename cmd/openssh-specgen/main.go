@@ -35,9 +35,13 @@ func main() {
 	}
 }
 
+// opensshTag is the OpenSSH release that testdata/openssh_client_spec.json
+// is generated from.
+const opensshTag = "V_10_2_P1"
+
 func cloneOpenSSH(dir string) error {
 	const repo = "https://github.com/openssh/openssh-portable.git"
-	if err := runCommand("git", "clone", "--depth=1", repo, dir); err != nil {
+	if err := runCommand("git", "clone", "--depth=1", "--branch", opensshTag, repo, dir); err != nil {
 		return fmt.Errorf("git clone: %w", err)
 	}
 	return nil
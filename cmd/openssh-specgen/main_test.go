@@ -26,7 +26,7 @@ func TestCloneOpenSSHUsesGit(t *testing.T) {
 		t.Fatalf("cloneOpenSSH: %v", err)
 	}
 
-	wantArgs := []string{"clone", "--depth=1", repo, target}
+	wantArgs := []string{"clone", "--depth=1", "--branch", "V_10_2_P1", repo, target}
 	if gotName != "git" {
 		t.Fatalf("expected git command, got %q", gotName)
 	}
@@ -0,0 +1,110 @@
+// Command ssh-config-fmt formats ssh_config files in a consistent style.
+//
+// Usage:
+//
+//	ssh-config-fmt [flags] [file ...]
+//
+// With no files it formats standard input. By default the formatted config is
+// written to standard output; -w rewrites the files in place and -l lists the
+// files whose formatting differs.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ncode/ssh_config"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("ssh-config-fmt", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	write := flags.Bool("w", false, "write the result to the files instead of standard output")
+	list := flags.Bool("l", false, "list the files whose formatting differs")
+	indent := flags.Int("indent", 2, "number of spaces to indent the lines in Host and Match blocks, or 0 for none")
+	tabs := flags.Bool("tabs", false, "indent with a tab instead of spaces")
+	var opts ssh_config.FormatOptions
+	flags.BoolVar(&opts.Equals, "equals", false, "separate keywords and values with \" = \"")
+	flags.BoolVar(&opts.KeepCase, "keep-case", false, "keep keywords as written")
+	flags.BoolVar(&opts.AlignComments, "align-comments", false, "align the trailing comments of each block")
+	flags.BoolVar(&opts.Compact, "compact", false, "remove blank lines")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *indent < 0 {
+		fmt.Fprintln(stderr, "ssh-config-fmt: -indent must not be negative")
+		return 2
+	}
+	opts.Indent = strings.Repeat(" ", *indent)
+	opts.NoIndent = *indent == 0
+	if *tabs {
+		opts.Indent, opts.NoIndent = "\t", false
+	}
+
+	if flags.NArg() == 0 {
+		if *write {
+			fmt.Fprintln(stderr, "ssh-config-fmt: cannot use -w with standard input")
+			return 2
+		}
+		in, err := io.ReadAll(stdin)
+		if err != nil {
+			fmt.Fprintf(stderr, "ssh-config-fmt: %v\n", err)
+			return 1
+		}
+		if err := format("<stdin>", in, opts, *list, false, stdout); err != nil {
+			fmt.Fprintf(stderr, "ssh-config-fmt: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+	status := 0
+	for _, path := range flags.Args() {
+		in, err := os.ReadFile(path)
+		if err == nil {
+			err = format(path, in, opts, *list, *write, stdout)
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "ssh-config-fmt: %v\n", err)
+			status = 1
+		}
+	}
+	return status
+}
+
+// format formats the config in, read from path. It lists path if list is set
+// and the config changes, rewrites path if write is set, and otherwise writes
+// the result to stdout. Included files are never read, since only the file
+// itself is formatted.
+func format(path string, in []byte, opts ssh_config.FormatOptions, list, write bool, stdout io.Writer) error {
+	cfg, err := ssh_config.DecodeOptions{DeferIncludes: true}.DecodeBytes(in)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	out := ssh_config.Format(cfg, opts)
+	changed := !bytes.Equal(in, out)
+	if list && changed {
+		fmt.Fprintln(stdout, path)
+	}
+	if write {
+		if !changed {
+			return nil
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(path, out, info.Mode().Perm())
+	}
+	if !list {
+		_, err = stdout.Write(out)
+	}
+	return err
+}
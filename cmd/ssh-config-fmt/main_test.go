@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunStdin(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	in := strings.NewReader("host a\n    user=bob # me\n")
+	if code := run([]string{"-tabs", "-equals"}, in, &stdout, &stderr); code != 0 {
+		t.Fatalf("run = %d, stderr %q", code, stderr.String())
+	}
+	want := "Host a\n\tUser = bob # me\n"
+	if got := stdout.String(); got != want {
+		t.Errorf("stdout = %q, want %q", got, want)
+	}
+}
+
+func TestRunNoIndent(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	in := strings.NewReader("Host a\n  User bob\n")
+	if code := run([]string{"-indent", "0"}, in, &stdout, &stderr); code != 0 {
+		t.Fatalf("run = %d, stderr %q", code, stderr.String())
+	}
+	if got, want := stdout.String(), "Host a\nUser bob\n"; got != want {
+		t.Errorf("stdout = %q, want %q", got, want)
+	}
+}
+
+func TestRunWriteAndList(t *testing.T) {
+	dir := t.TempDir()
+	messy := filepath.Join(dir, "messy")
+	tidy := filepath.Join(dir, "tidy")
+	if err := os.WriteFile(messy, []byte("Host a\n\tUser bob\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(tidy, []byte("Host a\n    User bob\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"-l", "-indent=4", messy, tidy}, nil, &stdout, &stderr); code != 0 {
+		t.Fatalf("run -l = %d, stderr %q", code, stderr.String())
+	}
+	if got := stdout.String(); got != messy+"\n" {
+		t.Errorf("run -l printed %q, want only %q", got, messy)
+	}
+
+	stdout.Reset()
+	if code := run([]string{"-w", "-indent=4", messy}, nil, &stdout, &stderr); code != 0 {
+		t.Fatalf("run -w = %d, stderr %q", code, stderr.String())
+	}
+	got, err := os.ReadFile(messy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "Host a\n    User bob\n" {
+		t.Errorf("rewritten file = %q", got)
+	}
+	if stdout.Len() != 0 {
+		t.Errorf("run -w printed %q", stdout.String())
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	bad := filepath.Join(t.TempDir(), "bad")
+	if err := os.WriteFile(bad, []byte("Host a\n  User \"bob\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if code := run([]string{bad}, nil, &stdout, &stderr); code != 1 {
+		t.Errorf("run = %d, want 1", code)
+	}
+	if !strings.Contains(stderr.String(), "invalid quotes") {
+		t.Errorf("stderr = %q, want the parse error", stderr.String())
+	}
+	if code := run([]string{"-w"}, strings.NewReader(""), &stdout, &stderr); code != 2 {
+		t.Errorf("run -w with stdin = %d, want 2", code)
+	}
+}
+
+func TestRunDoesNotReadIncludes(t *testing.T) {
+	dir := t.TempDir()
+	broken := filepath.Join(dir, "broken")
+	if err := os.WriteFile(broken, []byte("Host x\n  User \"bob\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	var stdout, stderr bytes.Buffer
+	in := strings.NewReader("include " + broken + "\ninclude " + filepath.Join(dir, "missing", "*.conf") + "\nhost a\n    user bob\n")
+	if code := run(nil, in, &stdout, &stderr); code != 0 {
+		t.Fatalf("run = %d, stderr %q", code, stderr.String())
+	}
+	want := "Include " + broken + "\nInclude " + filepath.Join(dir, "missing", "*.conf") + "\n\nHost a\n  User bob\n"
+	if got := stdout.String(); got != want {
+		t.Errorf("stdout = %q, want %q", got, want)
+	}
+}
@@ -30,13 +30,13 @@ package ssh_config
 import (
 	"bytes"
 	"errors"
-	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	osuser "os/user"
 	"path/filepath"
 	"regexp"
-	"runtime"
+	"slices"
 	"strings"
 	"sync"
 )
@@ -50,7 +50,11 @@ type configFinder func() string
 // UserSettings checks ~/.ssh and /etc/ssh for configuration files. The config
 // files are parsed and cached the first time Resolve is called.
 type UserSettings struct {
-	IgnoreErrors       bool
+	IgnoreErrors bool
+	// HomeDir is the home directory used to find ~/.ssh/config, to resolve
+	// relative Include paths and to expand ~ in paths. If empty, the current
+	// user's home directory is used.
+	HomeDir            string
 	customConfig       *Config
 	customConfigFinder configFinder
 	systemConfig       *Config
@@ -70,8 +74,11 @@ func homedir() string {
 	}
 }
 
-func userConfigFinder() string {
-	return filepath.Join(homedir(), ".ssh", "config")
+func (u *UserSettings) homeDir() string {
+	if u.HomeDir != "" {
+		return u.HomeDir
+	}
+	return homedir()
 }
 
 // DefaultUserSettings is the default UserSettings used for resolving configs.
@@ -80,7 +87,6 @@ func userConfigFinder() string {
 var DefaultUserSettings = &UserSettings{
 	IgnoreErrors:       false,
 	systemConfigFinder: systemConfigFinder,
-	userConfigFinder:   userConfigFinder,
 }
 
 func systemConfigFinder() string {
@@ -104,9 +110,10 @@ func (u *UserSettings) doLoadConfigs() {
 	u.loadConfigs.Do(func() {
 		var filename string
 		var err error
+		home := u.homeDir()
 		if u.customConfigFinder != nil {
 			filename = u.customConfigFinder()
-			u.customConfig, err = parseFile(filename)
+			u.customConfig, err = parseFile(filename, home, false)
 			// IsNotExist should be returned because a user specified this
 			// function - not existing likely means they made an error
 			if err != nil {
@@ -115,13 +122,12 @@ func (u *UserSettings) doLoadConfigs() {
 			return
 		}
 		if u.userConfigFinder == nil {
-			filename = userConfigFinder()
+			filename = filepath.Join(home, ".ssh", "config")
 		} else {
 			filename = u.userConfigFinder()
 		}
-		u.userConfig, err = parseFile(filename)
-		//lint:ignore S1002 I prefer it this way
-		if err != nil && os.IsNotExist(err) == false {
+		u.userConfig, err = parseFile(filename, home, false)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
 			u.onceErr = err
 			return
 		}
@@ -130,30 +136,61 @@ func (u *UserSettings) doLoadConfigs() {
 		} else {
 			filename = u.systemConfigFinder()
 		}
-		u.systemConfig, err = parseFile(filename)
-		//lint:ignore S1002 I prefer it this way
-		if err != nil && os.IsNotExist(err) == false {
+		u.systemConfig, err = parseFile(filename, home, true)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
 			u.onceErr = err
 			return
 		}
 	})
 }
 
-func parseFile(filename string) (*Config, error) {
-	return parseWithDepth(filename, 0)
+// parseOptions holds the settings used while parsing a config and the files
+// it includes.
+type parseOptions struct {
+	// system is set for the system-wide config and the files it includes,
+	// whose relative Include paths are resolved against /etc/ssh rather than
+	// ~/.ssh, as ssh does.
+	system bool
+	depth  uint8
+	// homeDir is used to resolve ~ and relative Include paths. If empty,
+	// the current user's home directory is used.
+	homeDir string
+	// tolerant makes the parser record errors and keep going; see
+	// DecodeOptions.
+	tolerant bool
+	// fsys, baseDir and deferIncludes are set from DecodeOptions; see there.
+	fsys          fs.FS
+	baseDir       string
+	deferIncludes bool
+	// filename is the file being parsed, if any.
+	filename string
 }
 
-func parseWithDepth(filename string, depth uint8) (*Config, error) {
-	b, err := os.ReadFile(filename)
-	if err != nil {
-		return nil, err
+func (o parseOptions) home() string {
+	if o.homeDir != "" {
+		return o.homeDir
 	}
-	return decodeBytes(b, isSystem(filename), depth)
+	return homedir()
 }
 
-func isSystem(filename string) bool {
-	// TODO: not sure this is the best way to detect a system repo
-	return strings.HasPrefix(filepath.Clean(filename), "/etc/ssh")
+func parseFile(filename, homeDir string, system bool) (*Config, error) {
+	return parseWithOptions(filename, parseOptions{homeDir: homeDir, system: system})
+}
+
+func parseWithOptions(filename string, opts parseOptions) (*Config, error) {
+	b, err := opts.readFile(filename)
+	if err != nil {
+		return nil, ioError(filename, err)
+	}
+	opts.filename = filename
+	c, err := decodeBytes(b, opts)
+	if err != nil {
+		setFilename(err, filename)
+	}
+	if c != nil {
+		c.filename = filename
+	}
+	return c, err
 }
 
 // Decode reads r into a Config, or returns an error if r could not be parsed as
@@ -161,44 +198,95 @@ func isSystem(filename string) bool {
 func Decode(r io.Reader) (*Config, error) {
 	b, err := io.ReadAll(r)
 	if err != nil {
-		return nil, err
+		return nil, ioError("", err)
 	}
-	return decodeBytes(b, false, 0)
+	return decodeBytes(b, parseOptions{})
 }
 
 // DecodeBytes reads b into a Config, or returns an error if r could not be
 // parsed as an SSH config file.
 func DecodeBytes(b []byte) (*Config, error) {
-	return decodeBytes(b, false, 0)
+	return decodeBytes(b, parseOptions{})
+}
+
+// DecodeOptions controls decoding.
+type DecodeOptions struct {
+	// Tolerant makes decoding continue after errors, for tools such as
+	// linters and editors that need every problem in a file. Lines that
+	// cannot be parsed are kept as BadLine nodes, a Match line with invalid
+	// criteria starts a block that never matches, and an Include that fails
+	// keeps the files it could parse, so the Config still prints back as it
+	// was read. The error returned with the Config is then a ParseErrors
+	// listing every error.
+	Tolerant bool
+	// FS is the file system that Include directives read files from. Its
+	// root stands for /, so the file /etc/ssh/ssh_config.d/a.conf is
+	// "etc/ssh/ssh_config.d/a.conf" in FS. An fstest.MapFS, a zip.Reader or
+	// an os.DirFS of a directory holding a copy of a home directory can be
+	// used to decode configs without reading the real ~/.ssh. If nil, the
+	// operating system's file system is used.
+	FS fs.FS
+	// BaseDir is the directory that relative Include paths are resolved
+	// against. If empty, ~/.ssh is used.
+	BaseDir string
+	// HomeDir is used to expand ~ in Include paths. If empty, the current
+	// user's home directory is used.
+	HomeDir string
+	// DeferIncludes defers reading the files of Include directives until
+	// Resolve or Validate first reaches them, so that decoding reads nothing
+	// but the config itself. Errors in included files are then returned by
+	// Resolve and Validate rather than by Decode. With Tolerant set, Resolve
+	// ignores them and uses the included files that could be parsed.
+	DeferIncludes bool
+}
+
+// Decode reads r into a Config according to o. In tolerant mode it returns
+// a Config even if there are parse errors.
+func (o DecodeOptions) Decode(r io.Reader) (*Config, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, ioError("", err)
+	}
+	return o.DecodeBytes(b)
 }
 
-func decodeBytes(b []byte, system bool, depth uint8) (c *Config, err error) {
-	defer func() {
-		if r := recover(); r != nil {
-			if _, ok := r.(runtime.Error); ok {
-				panic(r)
-			}
-			if e, ok := r.(error); ok && e == ErrDepthExceeded {
-				err = e
-				return
-			}
-			err = errors.New(r.(string))
-		}
-	}()
+// DecodeBytes reads b into a Config according to o. In tolerant mode it
+// returns a Config even if there are parse errors.
+func (o DecodeOptions) DecodeBytes(b []byte) (*Config, error) {
+	return decodeBytes(b, parseOptions{
+		tolerant:      o.Tolerant,
+		fsys:          o.FS,
+		baseDir:       o.BaseDir,
+		homeDir:       o.HomeDir,
+		deferIncludes: o.DeferIncludes,
+	})
+}
 
-	c = parseSSH(lexSSH(b), system, depth)
-	return c, err
+func decodeBytes(b []byte, opts parseOptions) (*Config, error) {
+	return parseSSH(b, opts)
 }
 
 // Config represents an SSH config file.
 type Config struct {
-	// A list of hosts to match against. The file begins with an implicit
-	// "Host *" declaration matching all hosts.
-	Hosts    []*Host
-	Blocks   []Block
+	// Hosts are the Host blocks of the config, in order. The file begins
+	// with an implicit "Host *" declaration matching all hosts.
+	Hosts []*Host
+	// Blocks are the Host and Match blocks of the config, in order. Hosts
+	// added to or removed from either Hosts or Blocks are added to or removed
+	// from the config; the order of the blocks is that of Blocks.
+	Blocks []Block
+	// synced are the Hosts when Hosts and Blocks last agreed, used to tell
+	// which of them changed.
+	synced   []*Host
 	depth    uint8
 	position Position
 	hasMatch bool
+	// filename is the file the config was read from, if any.
+	filename string
+	// bom is set if the file starts with a byte order mark, and
+	// noFinalNewline if its last line has no line ending.
+	bom            bool
+	noFinalNewline bool
 }
 
 // Context supplies data for Resolve, including Match evaluation.
@@ -209,8 +297,20 @@ type Context struct {
 	Version      string
 	SessionType  string
 	Command      string
-	Exec         func(cmd string) (bool, error)
+	// Exec runs the token-expanded command of Match exec and reports
+	// whether it succeeded. Within one Resolve call it is called at most
+	// once per command. See ExecRunner for a ready-made implementation.
+	Exec func(cmd string) (bool, error)
+	// LocalNetwork evaluates Match localnetwork. If nil, the CIDR list is
+	// checked against the interface addresses of this host; see
+	// LocalNetworkMatcher.
 	LocalNetwork func(cidr string) (bool, error)
+	// LookupEnv looks up environment variables for ${VAR} expansion. If nil,
+	// os.LookupEnv is used.
+	LookupEnv func(key string) (string, bool)
+	// HomeDir is the local home directory, used to expand ~ and %d. If empty,
+	// UserSettings.HomeDir or the current user's home directory is used.
+	HomeDir string
 }
 
 // ResolveOption configures Resolve behavior.
@@ -218,7 +318,11 @@ type ResolveOption func(*resolveOptions)
 
 // Result holds resolved configuration values.
 type Result struct {
-	values map[string][]string
+	values  map[string][]string
+	origins map[string][]Origin
+	// ctx and spec are kept for token expansion.
+	ctx  Context
+	spec *clientSpec
 }
 
 // Get returns the effective value for key, or empty string if none.
@@ -233,8 +337,18 @@ func (r *Result) Get(key string) string {
 	return vals[0]
 }
 
-// GetAll returns all effective values for key.
+// GetAll returns all effective values for key. Values are unquoted, and the
+// arguments of directives that take several, such as UserKnownHostsFile, are
+// joined by spaces; use GetList to get them one by one. Commands such as
+// ProxyCommand are returned as written.
 func (r *Result) GetAll(key string) []string {
+	return r.unquoted(key, r.rawValues(key))
+}
+
+// rawValues returns a copy of the values for key as resolved. The arguments
+// of list and forward directives are kept quoted as written, so that they can
+// be split again.
+func (r *Result) rawValues(key string) []string {
 	if r == nil {
 		return nil
 	}
@@ -247,6 +361,22 @@ func (r *Result) GetAll(key string) []string {
 	return out
 }
 
+// unquoted replaces the raw values vals of a list or forward directive key
+// with their arguments joined by spaces.
+func (r *Result) unquoted(key string, vals []string) []string {
+	if len(vals) == 0 {
+		return vals
+	}
+	d, err := r.directive(key)
+	if err != nil || (d.Type != "list" && d.Type != "forward") {
+		return vals
+	}
+	for i, val := range vals {
+		vals[i] = strings.Join(splitArgs(val), " ")
+	}
+	return vals
+}
+
 // String returns a string representation of the Config file.
 func (c Config) String() string {
 	return marshal(c).String()
@@ -256,23 +386,96 @@ func (c Config) MarshalText() ([]byte, error) {
 	return marshal(c).Bytes(), nil
 }
 
+// effectiveBlocks returns the blocks of c, including changes made through
+// c.Hosts. See reconcile.
 func (c Config) effectiveBlocks() []Block {
-	if len(c.Blocks) > 0 {
-		return c.Blocks
+	blocks, _ := c.reconcile()
+	return blocks
+}
+
+// reconcile merges the changes made to c.Blocks and c.Hosts since c was
+// decoded or last edited with the editing API, and returns the resulting
+// blocks and hosts. A Host appended to Hosts is placed after the Host that
+// precedes it there and given its layout, as by InsertBlockAfter; a Host
+// removed from either slice is removed from both.
+// The order of the blocks is that of Blocks. A Config without Blocks, such
+// as one built by hand, is made of its Hosts.
+func (c Config) reconcile() ([]Block, []*Host) {
+	if len(c.Blocks) == 0 {
+		blocks := make([]Block, 0, len(c.Hosts))
+		for _, host := range c.Hosts {
+			blocks = append(blocks, host)
+		}
+		return blocks, c.Hosts
 	}
-	blocks := make([]Block, 0, len(c.Hosts))
-	for _, host := range c.Hosts {
-		blocks = append(blocks, host)
+	blocks := c.Blocks
+	if !slices.Equal(c.Hosts, c.synced) {
+		inHosts := make(map[*Host]bool, len(c.Hosts))
+		for _, h := range c.Hosts {
+			inHosts[h] = true
+		}
+		synced := make(map[*Host]bool, len(c.synced))
+		for _, h := range c.synced {
+			synced[h] = true
+		}
+		blocks = make([]Block, 0, len(c.Blocks)+len(c.Hosts))
+		inBlocks := make(map[*Host]bool, len(c.Blocks))
+		for _, b := range c.Blocks {
+			if h, ok := b.(*Host); ok {
+				if synced[h] && !inHosts[h] {
+					continue // removed from Hosts
+				}
+				inBlocks[h] = true
+			}
+			blocks = append(blocks, b)
+		}
+		blank := c.blankLinesBetweenBlocks()
+		var prev Block
+		for _, h := range c.Hosts {
+			switch {
+			case inBlocks[h]:
+				prev = h
+			case !synced[h]:
+				// Added to Hosts. It takes the layout of the block it
+				// follows, or of the first block.
+				i := slices.Index(blocks, prev) + 1
+				mark := prev
+				if mark == nil && len(blocks) > 0 {
+					mark = blocks[0]
+				}
+				fitBlock(blocks, i, h, mark, blank)
+				blocks = slices.Insert(blocks, i, Block(h))
+				prev = h
+			}
+		}
 	}
-	return blocks
+	hosts := make([]*Host, 0, len(c.Hosts))
+	for _, b := range blocks {
+		if h, ok := b.(*Host); ok {
+			hosts = append(hosts, h)
+		}
+	}
+	return blocks, hosts
+}
+
+// sync applies reconcile to c, before c is edited.
+func (c *Config) sync() {
+	c.Blocks, c.Hosts = c.reconcile()
+	c.synced = slices.Clone(c.Hosts)
 }
 
 func marshal(c Config) *bytes.Buffer {
 	var buf bytes.Buffer
+	if c.bom {
+		buf.WriteString(byteOrderMark)
+	}
 	blocks := c.effectiveBlocks()
 	for i := range blocks {
 		buf.WriteString(blocks[i].String())
 	}
+	if c.noFinalNewline && bytes.HasSuffix(buf.Bytes(), []byte("\n")) {
+		buf.Truncate(buf.Len() - 1)
+	}
 	return &buf
 }
 
@@ -314,6 +517,7 @@ func NewPattern(s string) (*Pattern, error) {
 	if s == "" {
 		return nil, errors.New("ssh_config: empty pattern")
 	}
+	str := s
 	negated := false
 	if s[0] == '!' {
 		negated = true
@@ -341,7 +545,7 @@ func NewPattern(s string) (*Pattern, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &Pattern{str: s, regex: r, not: negated}, nil
+	return &Pattern{str: str, regex: r, not: negated}, nil
 }
 
 // Host describes a Host directive and the keywords that follow it.
@@ -352,20 +556,40 @@ type Host struct {
 	Nodes []Node
 	// EOLComment is the comment (if any) terminating the Host line.
 	EOLComment string
+	// LeadingComments are the comment lines and blank lines before the Host
+	// line that belong to it. They are written before it and move with it.
+	LeadingComments []*Empty
 	// Whitespace if any between the Host declaration and a trailing comment.
 	spaceBeforeComment string
 
-	hasEquals    bool
-	leadingSpace int // TODO: handle spaces vs tabs here.
+	// rawPatterns is the pattern list as written, and parsedPatterns the
+	// patterns it was parsed into. String reuses rawPatterns while Patterns
+	// are unchanged.
+	rawPatterns    string
+	parsedPatterns []*Pattern
+
+	lineFormat
+	keyword   string // "Host" as written
+	hasEquals bool
 	// The file starts with an implicit "Host *" declaration.
 	implicit bool
 	position Position
+	// like is the layout of the directives of the block h was inserted next
+	// to, used for new directives while h has none of its own.
+	like *nodeLayout
 }
 
 // Matches returns true if the Host matches for the given alias. For
 // a description of the rules that provide a match, see the manpage for
 // ssh_config.
 func (h *Host) Matches(alias string) bool {
+	found, _ := h.match(alias)
+	return found
+}
+
+// match reports whether h matches alias, and if a negated pattern prevented
+// the match, returns that pattern.
+func (h *Host) match(alias string) (bool, *Pattern) {
 	found := false
 	for i := range h.Patterns {
 		if h.Patterns[i].regex.MatchString(alias) {
@@ -376,12 +600,12 @@ func (h *Host) Matches(alias string) bool {
 				// whether any other patterns on the line match. Negated matches
 				// are therefore useful to provide exceptions for wildcard
 				// matches."
-				return false
+				return false, h.Patterns[i]
 			}
 			found = true
 		}
 	}
-	return found
+	return found, nil
 }
 
 // Pos returns h's Position.
@@ -391,43 +615,123 @@ func (h *Host) Pos() Position {
 
 func (h *Host) block() {}
 
-// String prints h as it would appear in a config file. Minor tweaks may be
-// present in the whitespace in the printed file.
+// String prints h as it would appear in a config file. A parsed Host is
+// printed exactly as it was read, except for the parts that were modified.
 func (h *Host) String() string {
 	var buf strings.Builder
+	writeComments(&buf, h.LeadingComments)
 	//lint:ignore S1002 I prefer to write it this way
 	if h.implicit == false {
-		buf.WriteString(strings.Repeat(" ", int(h.leadingSpace)))
-		buf.WriteString("Host")
-		if h.hasEquals {
-			buf.WriteString(" = ")
-		} else {
-			buf.WriteString(" ")
-		}
-		for i, pat := range h.Patterns {
-			buf.WriteString(pat.String())
-			if i < len(h.Patterns)-1 {
-				buf.WriteString(" ")
-			}
-		}
+		buf.WriteString(h.indent)
+		buf.WriteString(keywordOr(h.keyword, "Host"))
+		buf.WriteString(h.separator(h.hasEquals))
+		buf.WriteString(h.patternsString())
 		buf.WriteString(h.spaceBeforeComment)
-		if h.EOLComment != "" {
-			buf.WriteByte('#')
-			buf.WriteString(h.EOLComment)
+		buf.WriteString(h.comment(h.EOLComment))
+		buf.WriteString(h.lineEnding())
+	}
+	writeNodes(&buf, h.Nodes)
+	return buf.String()
+}
+
+func (h *Host) patternsString() string {
+	if h.parsedPatterns != nil && slices.Equal(h.Patterns, h.parsedPatterns) {
+		return h.rawPatterns
+	}
+	strs := make([]string, len(h.Patterns))
+	for i, pat := range h.Patterns {
+		strs[i] = pat.String()
+	}
+	return joinArgs(strs)
+}
+
+// writeNodes writes each node on its own line, after its leading comments.
+func writeNodes(buf *strings.Builder, nodes []Node) {
+	for _, node := range nodes {
+		switch n := node.(type) {
+		case *KV:
+			writeComments(buf, n.LeadingComments)
+		case *Include:
+			writeComments(buf, n.LeadingComments)
+		}
+		buf.WriteString(node.String())
+		if n, ok := node.(interface{ lineEnding() string }); ok {
+			buf.WriteString(n.lineEnding())
+		} else {
+			buf.WriteByte('\n')
 		}
-		buf.WriteByte('\n')
 	}
-	for i := range h.Nodes {
-		buf.WriteString(h.Nodes[i].String())
-		buf.WriteByte('\n')
+}
+
+// writeComments writes each comment line on its own line.
+func writeComments(buf *strings.Builder, comments []*Empty) {
+	for _, e := range comments {
+		buf.WriteString(e.String())
+		buf.WriteString(e.lineEnding())
 	}
-	return buf.String()
 }
 
-// Block represents a top-level block in a Config.
+// isBlank reports whether e is a blank line rather than a comment.
+func (e *Empty) isBlank() bool {
+	return e.Comment == "" && !e.emptyComment
+}
+
+// lineFormat records the layout of a parsed line, so that String can write
+// it back byte for byte. The zero value is the default layout.
+type lineFormat struct {
+	// indent is the whitespace before the keyword.
+	indent string
+	// sep is the text between the keyword and the value, such as " ", "\t"
+	// or " = ". If empty, " " or " = " is used.
+	sep string
+	// emptyComment is set if the line ends in a "#" without comment text.
+	emptyComment bool
+	// eol is the line ending. If empty, "\n" is used.
+	eol string
+}
+
+func (f *lineFormat) separator(hasEquals bool) string {
+	switch {
+	case f.sep != "":
+		return f.sep
+	case hasEquals:
+		return " = "
+	}
+	return " "
+}
+
+// comment returns text as a comment, or "" if there is no comment.
+func (f *lineFormat) comment(text string) string {
+	if text == "" && !f.emptyComment {
+		return ""
+	}
+	return "#" + text
+}
+
+func (f *lineFormat) lineEnding() string {
+	if f.eol == "" {
+		return "\n"
+	}
+	return f.eol
+}
+
+func keywordOr(keyword, def string) string {
+	if keyword == "" {
+		return def
+	}
+	return keyword
+}
+
+// Block represents a top-level block in a Config: a Host or a Match.
 type Block interface {
 	Pos() Position
 	String() string
+	// Set, Add, Delete and Insert edit the directives of the block. See
+	// Host.Set, Host.Add, Host.Delete and Host.Insert.
+	Set(key, value string) *KV
+	Add(key, value string) *KV
+	Delete(key string) int
+	Insert(i int, node Node)
 	block()
 }
 
@@ -439,18 +743,56 @@ type Node interface {
 
 // Match describes a Match directive and the keywords that follow it.
 type Match struct {
-	// Criteria is the raw criteria string after the Match directive.
-	Criteria string
+	// Criteria are the parsed criteria of the Match line. They may be
+	// modified; String writes them back.
+	Criteria []MatchCriterion
 	// A Node is either a key/value pair or a comment line.
 	Nodes []Node
 	// EOLComment is the comment (if any) terminating the Match line.
 	EOLComment string
+	// LeadingComments are the comment lines and blank lines before the Match
+	// line that belong to it. See Host.LeadingComments.
+	LeadingComments []*Empty
 	// Whitespace if any between the Match declaration and a trailing comment.
 	spaceBeforeComment string
 
-	hasEquals    bool
-	leadingSpace int // Space before the Match keyword.
-	position     Position
+	// rawCriteria is the criteria text as written, and parsedCriteria the
+	// criteria it was parsed into. String reuses rawCriteria while Criteria
+	// are unchanged.
+	rawCriteria    string
+	parsedCriteria []MatchCriterion
+	// err is set if tolerant decoding could not parse rawCriteria.
+	err *ParseError
+
+	lineFormat
+	keyword   string // "Match" as written
+	hasEquals bool
+	position  Position
+	like      *nodeLayout // see Host.like
+}
+
+// BadLine is a line that could not be parsed. Only tolerant decoding produces
+// BadLine nodes; see DecodeOptions. Resolve ignores them.
+type BadLine struct {
+	// Text is the line as it appears in the file, without the line ending.
+	Text string
+	// Err is the error reported for the line.
+	Err *ParseError
+	lineFormat
+	position Position
+}
+
+// Pos returns b's Position.
+func (b *BadLine) Pos() Position {
+	return b.position
+}
+
+// String returns b.Text.
+func (b *BadLine) String() string {
+	if b == nil {
+		return ""
+	}
+	return b.Text
 }
 
 // Pos returns m's Position.
@@ -466,24 +808,15 @@ func (m *Match) String() string {
 		return ""
 	}
 	var buf strings.Builder
-	buf.WriteString(strings.Repeat(" ", int(m.leadingSpace)))
-	buf.WriteString("Match")
-	if m.hasEquals {
-		buf.WriteString(" = ")
-	} else {
-		buf.WriteString(" ")
-	}
-	buf.WriteString(m.Criteria)
+	writeComments(&buf, m.LeadingComments)
+	buf.WriteString(m.indent)
+	buf.WriteString(keywordOr(m.keyword, "Match"))
+	buf.WriteString(m.separator(m.hasEquals))
+	buf.WriteString(m.criteriaString())
 	buf.WriteString(m.spaceBeforeComment)
-	if m.EOLComment != "" {
-		buf.WriteByte('#')
-		buf.WriteString(m.EOLComment)
-	}
-	buf.WriteByte('\n')
-	for i := range m.Nodes {
-		buf.WriteString(m.Nodes[i].String())
-		buf.WriteByte('\n')
-	}
+	buf.WriteString(m.comment(m.EOLComment))
+	buf.WriteString(m.lineEnding())
+	writeNodes(&buf, m.Nodes)
 	return buf.String()
 }
 
@@ -495,9 +828,13 @@ type KV struct {
 	// Whitespace after the value but before any comment
 	spaceAfterValue string
 	Comment         string
-	hasEquals       bool
-	leadingSpace    int // Space before the key. TODO handle spaces vs tabs.
-	position        Position
+	// LeadingComments are the comment lines and blank lines before k that
+	// belong to it. The block that holds k writes them before it, and they
+	// move with it.
+	LeadingComments []*Empty
+	lineFormat
+	hasEquals bool
+	position  Position
 }
 
 // Pos returns k's Position.
@@ -505,27 +842,20 @@ func (k *KV) Pos() Position {
 	return k.position
 }
 
-// String prints k as it was parsed in the config file.
+// String prints k as it was parsed in the config file, without its leading
+// comments.
 func (k *KV) String() string {
 	if k == nil {
 		return ""
 	}
-	equals := " "
-	if k.hasEquals {
-		equals = " = "
-	}
-	line := strings.Repeat(" ", int(k.leadingSpace)) + k.Key + equals + k.Value + k.spaceAfterValue
-	if k.Comment != "" {
-		line += "#" + k.Comment
-	}
-	return line
+	return k.indent + k.Key + k.separator(k.hasEquals) + k.Value + k.spaceAfterValue + k.comment(k.Comment)
 }
 
 // Empty is a line in the config file that contains only whitespace or comments.
 type Empty struct {
-	Comment      string
-	leadingSpace int // TODO handle spaces vs tabs.
-	position     Position
+	Comment string
+	lineFormat
+	position Position
 }
 
 // Pos returns e's Position.
@@ -538,10 +868,7 @@ func (e *Empty) String() string {
 	if e == nil {
 		return ""
 	}
-	if e.Comment == "" {
-		return ""
-	}
-	return fmt.Sprintf("%s#%s", strings.Repeat(" ", int(e.leadingSpace)), e.Comment)
+	return e.indent + e.comment(e.Comment)
 }
 
 // Include holds the result of an Include directive, including the config files
@@ -551,18 +878,29 @@ type Include struct {
 	// Comment is the contents of any comment at the end of the Include
 	// statement.
 	Comment string
+	// LeadingComments are the comment lines and blank lines before the
+	// Include line that belong to it. See KV.LeadingComments.
+	LeadingComments []*Empty
 	// an include directive can include several different files, and wildcards
 	directives []string
+	// rawDirectives is the directive list as written.
+	rawDirectives string
+	// Whitespace if any between the directives and a trailing comment.
+	spaceBeforeComment string
 
 	// 1:1 mapping between matches and keys in files array; matches preserves
 	// ordering
 	matches []string
 	// actual filenames are listed here
-	files        map[string]*Config
-	leadingSpace int
-	position     Position
-	depth        uint8
-	hasEquals    bool
+	files map[string]*Config
+	// lazy is set if reading the files was deferred; see
+	// DecodeOptions.DeferIncludes.
+	lazy *lazyInclude
+	lineFormat
+	keyword   string // "Include" as written
+	position  Position
+	depth     uint8
+	hasEquals bool
 }
 
 const maxRecurseDepth = 5
@@ -592,42 +930,32 @@ func removeDups(arr []string) []string {
 // Any error encountered while parsing nested configuration files will be
 // returned.
 func NewInclude(directives []string, hasEquals bool, pos Position, comment string, system bool, depth uint8) (*Include, error) {
-	if depth > maxRecurseDepth {
-		return nil, ErrDepthExceeded
-	}
+	return newInclude(directives, hasEquals, pos, comment, parseOptions{system: system, depth: depth})
+}
+
+// newInclude parses the files matched by directives, unless opts defer
+// reading them until the Include is resolved. In tolerant mode it returns the
+// Include along with every error, which may be a ParseErrors from an included
+// file; otherwise it stops at the first error.
+func newInclude(directives []string, hasEquals bool, pos Position, comment string, opts parseOptions) (*Include, error) {
 	inc := &Include{
-		Comment:      comment,
-		directives:   directives,
-		files:        make(map[string]*Config),
-		position:     pos,
-		leadingSpace: pos.Col - 1,
-		depth:        depth,
-		hasEquals:    hasEquals,
-	}
-	matches := make([]string, 0)
-	for i := range directives {
-		var path string
-		if filepath.IsAbs(directives[i]) {
-			path = directives[i]
-		} else if system {
-			path = filepath.Join("/etc/ssh", directives[i])
-		} else {
-			path = filepath.Join(homedir(), ".ssh", directives[i])
-		}
-		theseMatches, err := filepath.Glob(path)
-		if err != nil {
-			return nil, err
-		}
-		matches = append(matches, theseMatches...)
-	}
-	matches = removeDups(matches)
-	inc.matches = matches
-	for i := range matches {
-		config, err := parseWithDepth(matches[i], depth)
-		if err != nil {
+		Comment:    comment,
+		directives: directives,
+		files:      make(map[string]*Config),
+		position:   pos,
+		lineFormat: lineFormat{indent: strings.Repeat(" ", max(pos.Col-1, 0))},
+		depth:      opts.depth,
+		hasEquals:  hasEquals,
+	}
+	if opts.deferIncludes {
+		inc.lazy = &lazyInclude{opts: opts}
+		return inc, nil
+	}
+	if err := inc.read(opts); err != nil {
+		if !opts.tolerant {
 			return nil, err
 		}
-		inc.files[matches[i]] = config
+		return inc, err
 	}
 	return inc, nil
 }
@@ -640,15 +968,15 @@ func (i *Include) Pos() Position {
 // String prints out a string representation of this Include directive. Note
 // included Config files are not printed as part of this representation.
 func (inc *Include) String() string {
-	equals := " "
-	if inc.hasEquals {
-		equals = " = "
+	directives := inc.rawDirectives
+	if directives == "" {
+		directives = joinArgs(inc.directives)
 	}
-	line := fmt.Sprintf("%sInclude%s%s", strings.Repeat(" ", int(inc.leadingSpace)), equals, strings.Join(inc.directives, " "))
-	if inc.Comment != "" {
-		line += " #" + inc.Comment
+	spaceBeforeComment := inc.spaceBeforeComment
+	if spaceBeforeComment == "" && inc.rawDirectives == "" && inc.Comment != "" {
+		spaceBeforeComment = " "
 	}
-	return line
+	return inc.indent + keywordOr(inc.keyword, "Include") + inc.separator(inc.hasEquals) + directives + spaceBeforeComment + inc.comment(inc.Comment)
 }
 
 var matchAll *Pattern
@@ -671,6 +999,7 @@ func newConfig() *Config {
 	return &Config{
 		Hosts:  []*Host{implicitHost},
 		Blocks: []Block{implicitHost},
+		synced: []*Host{implicitHost},
 		depth:  0,
 	}
 }
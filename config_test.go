@@ -2,9 +2,11 @@ package ssh_config
 
 import (
 	"bytes"
+	"errors"
 	"log"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
 )
@@ -21,7 +23,16 @@ func loadFile(t *testing.T, filename string) []byte {
 var files = []string{
 	"testdata/config1",
 	"testdata/config2",
+	"testdata/config3",
+	"testdata/config4",
+	"testdata/config-no-ending-newline",
+	"testdata/dos-lines",
 	"testdata/eol-comments",
+	"testdata/eqsign",
+	"testdata/extraspace",
+	"testdata/match-directive",
+	"testdata/negated",
+	"testdata/config-tabs",
 }
 
 func TestDecode(t *testing.T) {
@@ -38,6 +49,55 @@ func TestDecode(t *testing.T) {
 	}
 }
 
+func TestDecodeRoundTripExact(t *testing.T) {
+	tests := []string{
+		"",
+		"\n",
+		"Host a\n\tPort 22\n  \tUser bob\n",
+		"Host a\r\n  Port 22\r\n\r\n# comment\r\n",
+		"Host a\n  Port 22\r\n\n",
+		"\uFEFFHost a\n  Port 22\n",
+		"Host a\n  Port 22",
+		"Host a\n  Port 22 # trailing",
+		"# only a comment",
+		"#\n  #\n\t# indented\n",
+		"   \n\t\n",
+		"host\ta  b\t# c\n\tport\t=\t22\t#\n",
+		"Host = !a b\n  HostName=example.com\n",
+		"Match\thost a   #\n  User x\n",
+		"Include\tnonexistent-a   nonexistent-b#no space\n",
+		"Include = nonexistent-a\r\n",
+		"Port 22\r",
+		"  \r  Port 22\n",
+	}
+	for _, input := range tests {
+		cfg, err := Decode(strings.NewReader(input))
+		if err != nil {
+			t.Errorf("Decode(%q): %v", input, err)
+			continue
+		}
+		if got := cfg.String(); got != input {
+			t.Errorf("round trip mismatch:\ngot:  %q\nwant: %q", got, input)
+		}
+	}
+}
+
+func TestEditKeepsLayout(t *testing.T) {
+	input := "\uFEFFHost a\r\n\tPort\t22\t# ssh\r\n\tUser bob"
+	cfg, err := Decode(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	host := cfg.Blocks[1].(*Host)
+	host.Nodes[0].(*KV).Value = "2222"
+	pat, _ := NewPattern("b")
+	host.Patterns = append(host.Patterns, pat)
+	want := "\uFEFFHost a b\r\n\tPort\t2222\t# ssh\r\n\tUser bob"
+	if got := cfg.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
 func testConfigFinder(filename string) func() string {
 	return func() string { return filename }
 }
@@ -300,9 +360,13 @@ func TestIncludeRecursive(t *testing.T) {
 		userConfigFinder: testConfigFinder("testdata/include-recursive"),
 	}
 	_, err = us.Resolve(Context{HostArg: "kevinburke.ssh_config.test.example.com"})
-	if err != ErrDepthExceeded {
+	if !errors.Is(err, ErrDepthExceeded) {
 		t.Errorf("Recursive include: expected ErrDepthExceeded, got %v", err)
 	}
+	var perr *ParseError
+	if !errors.As(err, &perr) || perr.Kind != KindDepthExceeded || perr.Filename != testPath {
+		t.Errorf("Recursive include: expected a depth ParseError in %s, got %#v", testPath, err)
+	}
 }
 
 func TestIncludeString(t *testing.T) {
@@ -430,7 +494,7 @@ func TestBlocksMutationAffectsResolveAndString(t *testing.T) {
 	host := &Host{
 		Patterns: []*Pattern{mustPattern(t, "block.example.com")},
 		Nodes: []Node{
-			&KV{Key: "User", Value: "block-user", leadingSpace: 2},
+			&KV{Key: "User", Value: "block-user", lineFormat: lineFormat{indent: "  "}},
 		},
 	}
 	cfg.Blocks = append(cfg.Blocks, host)
@@ -452,15 +516,15 @@ func TestBlocksMutationAffectsResolveAndString(t *testing.T) {
 	}
 }
 
-func TestHostsOnlyMutationIgnoredWhenBlocksPresent(t *testing.T) {
-	cfg, err := Decode(strings.NewReader("Host *\n  Port 22\n"))
+func TestHostsMutationAppliedWhenBlocksPresent(t *testing.T) {
+	cfg, err := Decode(strings.NewReader("Host *\n  Port 22\nMatch user deploy\n  Port 2222\n"))
 	if err != nil {
 		t.Fatalf("Decode: %v", err)
 	}
 	cfg.Hosts = append(cfg.Hosts, &Host{
 		Patterns: []*Pattern{mustPattern(t, "hostonly.example.com")},
 		Nodes: []Node{
-			&KV{Key: "User", Value: "hosts-only", leadingSpace: 2},
+			&KV{Key: "User", Value: "hosts-only", lineFormat: lineFormat{indent: "  "}},
 		},
 	})
 
@@ -468,13 +532,86 @@ func TestHostsOnlyMutationIgnoredWhenBlocksPresent(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Resolve: %v", err)
 	}
-	if got := res.Get("User"); got == "hosts-only" {
-		t.Fatalf("Hosts-only mutation unexpectedly affected Resolve result: %q", got)
+	if got := res.Get("User"); got != "hosts-only" {
+		t.Fatalf("User got %q, want %q", got, "hosts-only")
 	}
 
-	out := cfg.String()
-	if strings.Contains(out, "Host hostonly.example.com\n") {
-		t.Fatalf("String() unexpectedly includes Hosts-only mutation:\n%s", out)
+	// The new Host follows Host *, the Host before it in Hosts.
+	want := "Host *\n  Port 22\nHost hostonly.example.com\n  User hosts-only\nMatch user deploy\n  Port 2222\n"
+	if out := cfg.String(); out != want {
+		t.Fatalf("String() = %q, want %q", out, want)
+	}
+}
+
+func TestHostsMutationAdoptsLayout(t *testing.T) {
+	data := loadFile(t, "testdata/config-tabs")
+	cfg, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	bastion, err := NewHost("bastion")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bastion.Add("HostName", "10.0.0.1")
+	cache, err := NewHost("cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache.Add("Port", "6379")
+	cfg.Hosts = append(cfg.Hosts, bastion)
+	cfg.Hosts = slices.Insert(cfg.Hosts, 2, cache)
+
+	want := string(data[:bytes.Index(data, []byte("Host db"))]) +
+		"Host cache\n\tPort 6379\n\n" +
+		"Host db\n\tHostName db.example.com\n\n" +
+		"Host bastion\n\tHostName 10.0.0.1\n"
+	if out := cfg.String(); out != want {
+		t.Fatalf("String() = %q, want %q", out, want)
+	}
+	if out := cfg.String(); out != want {
+		t.Fatalf("second String() = %q, want %q", out, want)
+	}
+	cfg2, err := Decode(strings.NewReader(want))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if out := cfg2.String(); out != want {
+		t.Fatalf("round trip = %q, want %q", out, want)
+	}
+}
+
+func TestHostsAndBlocksRemoval(t *testing.T) {
+	cfg, err := Decode(strings.NewReader("Host a\n  User a\nHost b\n  User b\nHost c\n  User c\n"))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	// Remove Host a through Hosts and Host b through Blocks.
+	cfg.Hosts = slices.Delete(cfg.Hosts, 1, 2)
+	cfg.Blocks = slices.DeleteFunc(cfg.Blocks, func(b Block) bool {
+		h, ok := b.(*Host)
+		return ok && h.Matches("b") && !h.implicit
+	})
+	if out := cfg.String(); out != "Host c\n  User c\n" {
+		t.Fatalf("String() = %q", out)
+	}
+	for _, host := range []string{"a", "b"} {
+		res, err := cfg.Resolve(Context{HostArg: host})
+		if err != nil {
+			t.Fatalf("Resolve: %v", err)
+		}
+		if got := res.Get("User"); got == host {
+			t.Errorf("removed Host %s still applies", host)
+		}
+	}
+
+	// Editing brings both slices in line.
+	c := cfg.FindBlock("Host c")
+	if err := cfg.RemoveBlock(c); err != nil {
+		t.Fatalf("RemoveBlock: %v", err)
+	}
+	if len(cfg.Hosts) != 1 || len(cfg.Blocks) != 1 {
+		t.Errorf("got %d hosts and %d blocks, want only the implicit Host *", len(cfg.Hosts), len(cfg.Blocks))
 	}
 }
 
@@ -487,7 +624,7 @@ func TestHostsFallbackWhenBlocksEmpty(t *testing.T) {
 	cfg.Hosts = append(cfg.Hosts, &Host{
 		Patterns: []*Pattern{mustPattern(t, "fallback.example.com")},
 		Nodes: []Node{
-			&KV{Key: "User", Value: "fallback-user", leadingSpace: 2},
+			&KV{Key: "User", Value: "fallback-user", lineFormat: lineFormat{indent: "  "}},
 		},
 	})
 
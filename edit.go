@@ -0,0 +1,483 @@
+package ssh_config
+
+import (
+	"errors"
+	"slices"
+	"strings"
+)
+
+// NewKV returns a directive line. When it is added to a block, it takes the
+// indentation, separator and line ending of the directives around it.
+func NewKV(key, value string) *KV {
+	return &KV{Key: key, Value: value}
+}
+
+// NewComment returns a comment line "# text". NewComment("") returns an
+// empty line. Like NewKV, it takes the indentation of the block it is added
+// to.
+func NewComment(text string) *Empty {
+	if text == "" {
+		return &Empty{}
+	}
+	return &Empty{Comment: " " + text}
+}
+
+// NewHost returns a Host block for patterns. Patterns are quoted as needed
+// when it is written.
+func NewHost(patterns ...string) (*Host, error) {
+	if len(patterns) == 0 {
+		return nil, errors.New("ssh_config: Host needs at least one pattern")
+	}
+	h := &Host{Nodes: make([]Node, 0)}
+	for _, s := range patterns {
+		pat, err := NewPattern(s)
+		if err != nil {
+			return nil, err
+		}
+		h.Patterns = append(h.Patterns, pat)
+	}
+	return h, nil
+}
+
+// NewMatch returns a Match block for criteria, such as "host *.example.com
+// user deploy". It fails if ParseMatchCriteria does.
+func NewMatch(criteria string) (*Match, error) {
+	parsed, err := ParseMatchCriteria(criteria)
+	if err != nil {
+		return nil, err
+	}
+	return &Match{Criteria: parsed, Nodes: make([]Node, 0)}, nil
+}
+
+// Set sets key to value in h: the first directive for key is given value and
+// any later ones are deleted. If h has no directive for key, Set adds one.
+// value is written as is, so arguments that contain spaces must be quoted.
+func (h *Host) Set(key, value string) *KV {
+	return setKV(&h.Nodes, h.layout(), key, value)
+}
+
+// Add adds a directive for key after the last directive in h, even if h
+// already has one. This is how directives such as IdentityFile take several
+// values.
+func (h *Host) Add(key, value string) *KV {
+	return addKV(&h.Nodes, h.layout(), key, value)
+}
+
+// Delete deletes the directives for key from h and returns how many there
+// were.
+func (h *Host) Delete(key string) int {
+	return deleteKV(&h.Nodes, key)
+}
+
+// Insert inserts node into h.Nodes at index i. A node made with NewKV or
+// NewComment takes the layout of the directives around it; a node moved from
+// elsewhere in a config keeps its own.
+func (h *Host) Insert(i int, node Node) {
+	insertNode(&h.Nodes, h.layout(), i, node)
+}
+
+// Set sets key to value in m. See Host.Set.
+func (m *Match) Set(key, value string) *KV {
+	return setKV(&m.Nodes, m.layout(), key, value)
+}
+
+// Add adds a directive for key after the last directive in m. See Host.Add.
+func (m *Match) Add(key, value string) *KV {
+	return addKV(&m.Nodes, m.layout(), key, value)
+}
+
+// Delete deletes the directives for key from m and returns how many there
+// were.
+func (m *Match) Delete(key string) int {
+	return deleteKV(&m.Nodes, key)
+}
+
+// Insert inserts node into m.Nodes at index i. See Host.Insert.
+func (m *Match) Insert(i int, node Node) {
+	insertNode(&m.Nodes, m.layout(), i, node)
+}
+
+// nodeLayout is the layout that new lines in a block copy.
+type nodeLayout struct {
+	format    lineFormat
+	hasEquals bool
+}
+
+// layoutOf returns the layout of the last directive in nodes, if any.
+func layoutOf(nodes []Node) (nodeLayout, bool) {
+	for i := len(nodes) - 1; i >= 0; i-- {
+		if kv, ok := nodes[i].(*KV); ok && !kv.position.Invalid() {
+			return nodeLayout{format: kv.lineFormat, hasEquals: kv.hasEquals}, true
+		}
+	}
+	return nodeLayout{}, false
+}
+
+// layout returns the layout of new lines in h: that of its directives, of
+// the block it was inserted next to, or two spaces of indentation.
+func (h *Host) layout() nodeLayout {
+	if l, ok := layoutOf(h.Nodes); ok {
+		return l
+	}
+	if h.like != nil {
+		return *h.like
+	}
+	if h.implicit {
+		return nodeLayout{}
+	}
+	return nodeLayout{format: lineFormat{indent: "  ", eol: h.eol}, hasEquals: h.hasEquals}
+}
+
+func (m *Match) layout() nodeLayout {
+	if l, ok := layoutOf(m.Nodes); ok {
+		return l
+	}
+	if m.like != nil {
+		return *m.like
+	}
+	return nodeLayout{format: lineFormat{indent: "  ", eol: m.eol}, hasEquals: m.hasEquals}
+}
+
+// apply gives a new node the layout l. Separators that align values in
+// columns are replaced with a single space.
+func (l nodeLayout) apply(node Node) {
+	switch n := node.(type) {
+	case *KV:
+		l.applyComments(n.LeadingComments)
+		if !n.position.Invalid() {
+			return
+		}
+		n.indent, n.eol, n.hasEquals = l.format.indent, l.format.eol, l.hasEquals
+		n.sep = ""
+		if sep := l.format.sep; len(sep) == 1 || strings.Contains(sep, "=") {
+			n.sep = sep
+		}
+	case *Empty:
+		if !n.position.Invalid() {
+			return
+		}
+		if n.Comment != "" {
+			n.indent = l.format.indent
+		}
+		n.eol = l.format.eol
+	case *Include:
+		l.applyComments(n.LeadingComments)
+	}
+}
+
+// applyComments gives the new lines among comments the layout l.
+func (l nodeLayout) applyComments(comments []*Empty) {
+	for _, e := range comments {
+		l.apply(e)
+	}
+}
+
+// contentEnd returns the index after the last line of nodes that is not
+// blank, so that new lines go before the blank lines that separate blocks.
+func contentEnd(nodes []Node) int {
+	for i := len(nodes); i > 0; i-- {
+		if e, ok := nodes[i-1].(*Empty); !ok || e.Comment != "" || e.emptyComment {
+			return i
+		}
+	}
+	return 0
+}
+
+func insertNode(nodes *[]Node, l nodeLayout, i int, node Node) {
+	l.apply(node)
+	*nodes = slices.Insert(*nodes, i, node)
+}
+
+func addKV(nodes *[]Node, l nodeLayout, key, value string) *KV {
+	kv := NewKV(key, value)
+	insertNode(nodes, l, contentEnd(*nodes), kv)
+	return kv
+}
+
+func setKV(nodes *[]Node, l nodeLayout, key, value string) *KV {
+	var found *KV
+	*nodes = slices.DeleteFunc(*nodes, func(node Node) bool {
+		kv, ok := node.(*KV)
+		if !ok || !strings.EqualFold(kv.Key, key) {
+			return false
+		}
+		if found != nil {
+			return true
+		}
+		found = kv
+		return false
+	})
+	if found == nil {
+		return addKV(nodes, l, key, value)
+	}
+	found.Value = value
+	return found
+}
+
+func deleteKV(nodes *[]Node, key string) int {
+	before := len(*nodes)
+	*nodes = slices.DeleteFunc(*nodes, func(node Node) bool {
+		kv, ok := node.(*KV)
+		return ok && strings.EqualFold(kv.Key, key)
+	})
+	return before - len(*nodes)
+}
+
+// FindBlock returns the first Host or Match block whose header matches
+// header, such as "Host *.example.com" or "Match user deploy". Patterns and
+// criteria are compared after parsing, so quoting and spacing do not matter,
+// but their order does. FindBlock("") returns the implicit block at the start
+// of the file that holds the global options. It returns nil if no block
+// matches.
+func (c *Config) FindBlock(header string) Block {
+	header = strings.TrimSpace(header)
+	keyword, rest := header, ""
+	if i := strings.IndexAny(header, " \t="); i >= 0 {
+		keyword, rest = header[:i], strings.TrimLeft(header[i:], " \t=")
+	}
+	for _, block := range c.effectiveBlocks() {
+		switch b := block.(type) {
+		case *Host:
+			if b.implicit {
+				if header == "" {
+					return b
+				}
+				continue
+			}
+			if !strings.EqualFold(keyword, "host") {
+				continue
+			}
+			args, err := argvSplit(rest)
+			if err == nil && slices.EqualFunc(b.Patterns, args, func(p *Pattern, s string) bool {
+				return p.String() == s
+			}) {
+				return b
+			}
+		case *Match:
+			if !strings.EqualFold(keyword, "match") {
+				continue
+			}
+			criteria, err := ParseMatchCriteria(rest)
+			if err == nil && slices.Equal(b.Criteria, criteria) {
+				return b
+			}
+		}
+	}
+	return nil
+}
+
+// errBlockNotFound is returned when the block to insert next to or remove is
+// not in the Config.
+var errBlockNotFound = errors.New("ssh_config: block not found in config")
+
+// InsertBlockBefore inserts b before the block mark. b takes the layout of
+// mark: the indentation of its header and directives, its = style and its
+// line endings. Config.Hosts is updated too.
+func (c *Config) InsertBlockBefore(mark, b Block) error {
+	i := c.blockIndex(mark)
+	if i < 0 {
+		return errBlockNotFound
+	}
+	if i == 0 {
+		if h, ok := mark.(*Host); ok && h.implicit {
+			return errors.New("ssh_config: cannot insert a block before the implicit Host *")
+		}
+	}
+	c.insertBlock(i, b, mark)
+	return nil
+}
+
+// InsertBlockAfter inserts b after the block mark. If the blocks of c are
+// separated by blank lines, b is too. See InsertBlockBefore.
+func (c *Config) InsertBlockAfter(mark, b Block) error {
+	i := c.blockIndex(mark)
+	if i < 0 {
+		return errBlockNotFound
+	}
+	c.insertBlock(i+1, b, mark)
+	return nil
+}
+
+// RemoveBlock removes b from c.Blocks and c.Hosts. The implicit Host * at
+// the start of the file cannot be removed.
+func (c *Config) RemoveBlock(b Block) error {
+	if h, ok := b.(*Host); ok && h.implicit {
+		return errors.New("ssh_config: cannot remove the implicit Host *")
+	}
+	i := c.blockIndex(b)
+	if i < 0 {
+		return errBlockNotFound
+	}
+	c.Blocks = slices.Delete(c.Blocks, i, i+1)
+	if h, ok := b.(*Host); ok {
+		c.Hosts = slices.DeleteFunc(c.Hosts, func(host *Host) bool { return host == h })
+		c.synced = slices.Clone(c.Hosts)
+	}
+	return nil
+}
+
+// blockIndex returns the index of b in c.Blocks, or -1, after bringing
+// Blocks and Hosts in line.
+func (c *Config) blockIndex(b Block) int {
+	c.sync()
+	return slices.IndexFunc(c.Blocks, func(block Block) bool { return block == b })
+}
+
+func (c *Config) insertBlock(i int, b Block, mark Block) {
+	fitBlock(c.Blocks, i, b, mark, c.blankLinesBetweenBlocks())
+	switch b := b.(type) {
+	case *Host:
+		hostIndex := 0
+		for _, block := range c.Blocks[:i] {
+			if _, ok := block.(*Host); ok {
+				hostIndex++
+			}
+		}
+		c.Hosts = slices.Insert(c.Hosts, hostIndex, b)
+		c.synced = slices.Clone(c.Hosts)
+	case *Match:
+		c.hasMatch = true
+	}
+	c.Blocks = slices.Insert(c.Blocks, i, b)
+}
+
+// fitBlock gives the new block b, about to be inserted at index i of blocks,
+// the layout of its neighbour mark. If blank is set, b is separated from the
+// blocks around it by blank lines.
+func fitBlock(blocks []Block, i int, b, mark Block, blank bool) {
+	header, nodes := blockLayout(mark)
+	switch b := b.(type) {
+	case *Host:
+		b.adopt(header, nodes)
+	case *Match:
+		b.adopt(header, nodes)
+	}
+	if blank {
+		if i > 0 && !isEmptyImplicit(blocks[i-1]) {
+			prependBlankLine(b)
+		}
+		if i < len(blocks) {
+			prependBlankLine(blocks[i])
+		}
+	}
+}
+
+// blockLayout returns the layout of the header of b and of its directives.
+// The implicit Host * has no header, so its directives give both.
+func blockLayout(b Block) (header nodeLayout, nodes *nodeLayout) {
+	switch b := b.(type) {
+	case *Host:
+		if l, ok := layoutOf(b.Nodes); ok {
+			nodes = &l
+		}
+		if b.implicit {
+			if nodes != nil {
+				header = nodeLayout{format: lineFormat{eol: nodes.format.eol}, hasEquals: nodes.hasEquals}
+			}
+			return header, nil
+		}
+		return nodeLayout{format: b.lineFormat, hasEquals: b.hasEquals}, nodes
+	case *Match:
+		if l, ok := layoutOf(b.Nodes); ok {
+			nodes = &l
+		}
+		return nodeLayout{format: b.lineFormat, hasEquals: b.hasEquals}, nodes
+	}
+	return header, nil
+}
+
+// adopt gives a new block the header layout of its neighbour, and remembers
+// the layout of the neighbour's directives for new directives.
+func (h *Host) adopt(header nodeLayout, nodes *nodeLayout) {
+	if !h.position.Invalid() {
+		return
+	}
+	h.indent, h.eol, h.hasEquals = header.format.indent, header.format.eol, header.hasEquals
+	h.like = nodes
+	for _, node := range h.Nodes {
+		h.layout().apply(node)
+	}
+}
+
+func (m *Match) adopt(header nodeLayout, nodes *nodeLayout) {
+	if !m.position.Invalid() {
+		return
+	}
+	m.indent, m.eol, m.hasEquals = header.format.indent, header.format.eol, header.hasEquals
+	m.like = nodes
+	for _, node := range m.Nodes {
+		m.layout().apply(node)
+	}
+}
+
+// blankLinesBetweenBlocks reports whether the blocks of c are separated by
+// blank lines, which start the leading comments of all blocks but the first.
+func (c *Config) blankLinesBetweenBlocks() bool {
+	found := false
+	for i, block := range c.Blocks {
+		if i == 0 || (i == 1 && isEmptyImplicit(c.Blocks[0])) {
+			// Nothing comes before the block.
+			continue
+		}
+		if !separated(c.Blocks[i-1], block) {
+			return false
+		}
+		found = true
+	}
+	return found
+}
+
+// separated reports whether a blank line comes between the blocks prev and
+// b: at the end of prev, or at the start of the leading comments of b.
+func separated(prev, b Block) bool {
+	if nodes := blockNodes(prev); contentEnd(nodes) < len(nodes) {
+		return true
+	}
+	comments := leadingComments(b)
+	return len(comments) > 0 && comments[0].isBlank()
+}
+
+// isEmptyImplicit reports whether b is the implicit Host * of a config
+// without global options.
+func isEmptyImplicit(b Block) bool {
+	h, ok := b.(*Host)
+	return ok && h.implicit && len(h.Nodes) == 0
+}
+
+func blockNodes(b Block) []Node {
+	switch b := b.(type) {
+	case *Host:
+		return b.Nodes
+	case *Match:
+		return b.Nodes
+	}
+	return nil
+}
+
+func leadingComments(b Block) []*Empty {
+	switch b := b.(type) {
+	case *Host:
+		return b.LeadingComments
+	case *Match:
+		return b.LeadingComments
+	}
+	return nil
+}
+
+// prependBlankLine starts the leading comments of b with a blank line, if no
+// blank line already comes before it.
+func prependBlankLine(b Block) {
+	comments := leadingComments(b)
+	if len(comments) > 0 && comments[0].isBlank() {
+		return
+	}
+	switch b := b.(type) {
+	case *Host:
+		if b.implicit {
+			return
+		}
+		b.LeadingComments = slices.Insert(comments, 0, &Empty{lineFormat: lineFormat{eol: b.eol}})
+	case *Match:
+		b.LeadingComments = slices.Insert(comments, 0, &Empty{lineFormat: lineFormat{eol: b.eol}})
+	}
+}
@@ -0,0 +1,177 @@
+package ssh_config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBlockSetAddDelete(t *testing.T) {
+	cfg, err := Decode(strings.NewReader("Host a\n\tUser=x\n\tPort=22\n\tUser=y\n\nHost b\n    User bob\n"))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	a := cfg.FindBlock("Host a")
+	if a == nil {
+		t.Fatal("FindBlock(\"Host a\") = nil")
+	}
+	a.Set("user", "z")
+	a.Add("IdentityFile", `"~/.ssh/my key"`)
+	if n := a.Delete("Port"); n != 1 {
+		t.Errorf("Delete(Port) = %d, want 1", n)
+	}
+	b := cfg.FindBlock("Host b")
+	b.Set("Port", "2222")
+	b.Insert(0, NewComment("the b servers"))
+	want := "Host a\n\tUser=z\n\tIdentityFile=\"~/.ssh/my key\"\n\nHost b\n    # the b servers\n    User bob\n    Port 2222\n"
+	if got := cfg.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+
+	res, err := cfg.Resolve(Context{HostArg: "a"})
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if got := res.Get("User"); got != "z" {
+		t.Errorf("User = %q, want z", got)
+	}
+	if got := res.Get("IdentityFile"); !strings.HasSuffix(got, "/.ssh/my key") {
+		t.Errorf("IdentityFile = %q", got)
+	}
+}
+
+func TestFindBlock(t *testing.T) {
+	cfg, err := Decode(strings.NewReader("User root\nHost \"a b\" c\nMatch host=x user deploy\nHost *\n"))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	tests := []struct {
+		header string
+		index  int
+	}{
+		{"", 0},
+		{"Host 'a b'   c", 1},
+		{"host=\"a b\" c", 1},
+		{"Match host x user=deploy", 2},
+		{"Host *", 3},
+		{"Host c", -1},
+		{"Match host y", -1},
+	}
+	for _, tt := range tests {
+		got := cfg.FindBlock(tt.header)
+		if tt.index < 0 {
+			if got != nil {
+				t.Errorf("FindBlock(%q) = %v, want nil", tt.header, got)
+			}
+			continue
+		}
+		if got != cfg.Blocks[tt.index] {
+			t.Errorf("FindBlock(%q) = %v, want block %d", tt.header, got, tt.index)
+		}
+	}
+}
+
+func TestInsertRemoveBlock(t *testing.T) {
+	cfg, err := Decode(strings.NewReader("Host a\r\n\tUser = x\r\n\r\nHost b\r\n\tUser = y\r\n"))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	c, err := NewHost("c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Add("User", "z")
+	if err := cfg.InsertBlockAfter(cfg.FindBlock("Host b"), c); err != nil {
+		t.Fatalf("InsertBlockAfter: %v", err)
+	}
+	m, err := NewMatch("user deploy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Add("Port", "2222")
+	if err := cfg.InsertBlockBefore(cfg.FindBlock("Host b"), m); err != nil {
+		t.Fatalf("InsertBlockBefore: %v", err)
+	}
+	want := "Host a\r\n\tUser = x\r\n\r\nMatch user deploy\r\n\tPort = 2222\r\n\r\nHost b\r\n\tUser = y\r\n\r\nHost c\r\n\tUser = z\r\n"
+	if got := cfg.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	if len(cfg.Hosts) != 4 || cfg.Hosts[3] != c {
+		t.Errorf("Hosts not updated: %v", cfg.Hosts)
+	}
+	res, err := cfg.Resolve(Context{HostArg: "c"})
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if got := res.Get("User"); got != "z" {
+		t.Errorf("User = %q, want z", got)
+	}
+
+	if err := cfg.RemoveBlock(c); err != nil {
+		t.Fatalf("RemoveBlock: %v", err)
+	}
+	if err := cfg.RemoveBlock(c); err == nil {
+		t.Error("expected an error removing a block twice")
+	}
+	if err := cfg.RemoveBlock(cfg.FindBlock("")); err == nil {
+		t.Error("expected an error removing the implicit Host *")
+	}
+	if len(cfg.Hosts) != 3 || len(cfg.Blocks) != 4 {
+		t.Errorf("got %d hosts and %d blocks, want 3 and 4", len(cfg.Hosts), len(cfg.Blocks))
+	}
+	if strings.Contains(cfg.String(), "Host c") {
+		t.Errorf("removed block still printed:\n%s", cfg)
+	}
+}
+
+func TestInsertBlockIntoEmptyConfig(t *testing.T) {
+	cfg, err := Decode(strings.NewReader(""))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	h, err := NewHost("example.com", "!bad host")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.Set("HostName", "10.0.0.1")
+	if err := cfg.InsertBlockAfter(cfg.FindBlock(""), h); err != nil {
+		t.Fatalf("InsertBlockAfter: %v", err)
+	}
+	cfg.FindBlock("").Set("Compression", "yes")
+	want := "Compression yes\nHost example.com \"!bad host\"\n  HostName 10.0.0.1\n"
+	if got := cfg.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestCommentsMoveWithBlocks(t *testing.T) {
+	cfg, err := Decode(strings.NewReader("Host a\n  User alice\n\n# the b servers\nHost b\n  # keep this short\n  User bob\n  Port 22\n\n# the c servers\nHost c\n  User carol\n"))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	b := cfg.FindBlock("Host b")
+	if n := b.Delete("User"); n != 1 {
+		t.Errorf("Delete(User) = %d, want 1", n)
+	}
+	if err := cfg.RemoveBlock(b); err != nil {
+		t.Fatalf("RemoveBlock: %v", err)
+	}
+	want := "Host a\n  User alice\n\n# the c servers\nHost c\n  User carol\n"
+	if got := cfg.String(); got != want {
+		t.Errorf("after RemoveBlock, String() = %q, want %q", got, want)
+	}
+	if err := cfg.InsertBlockAfter(cfg.FindBlock("Host c"), b); err != nil {
+		t.Fatalf("InsertBlockAfter: %v", err)
+	}
+	want = "Host a\n  User alice\n\n# the c servers\nHost c\n  User carol\n\n# the b servers\nHost b\n  Port 22\n"
+	if got := cfg.String(); got != want {
+		t.Errorf("after InsertBlockAfter, String() = %q, want %q", got, want)
+	}
+
+	kv := NewKV("User", "bob")
+	kv.LeadingComments = []*Empty{NewComment("back again")}
+	b.Insert(0, kv)
+	want = "Host a\n  User alice\n\n# the c servers\nHost c\n  User carol\n\n# the b servers\nHost b\n  # back again\n  User bob\n  Port 22\n"
+	if got := cfg.String(); got != want {
+		t.Errorf("after Insert, String() = %q, want %q", got, want)
+	}
+}
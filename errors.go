@@ -0,0 +1,137 @@
+package ssh_config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+)
+
+// ErrorKind classifies a ParseError.
+type ErrorKind int
+
+const (
+	// KindSyntax is an unexpected token.
+	KindSyntax ErrorKind = iota + 1
+	// KindBadPattern is an invalid Host pattern.
+	KindBadPattern
+	// KindBadMatch is invalid Match criteria.
+	KindBadMatch
+	// KindInclude is an Include directive that could not be processed, such
+	// as an invalid glob or an unknown ~user.
+	KindInclude
+	// KindDepthExceeded is an Include nested too deeply, usually a loop. The
+	// error wraps ErrDepthExceeded.
+	KindDepthExceeded
+	// KindMissingValue is a directive without a value.
+	KindMissingValue
+	// KindIO is an error reading a config file.
+	KindIO
+	// KindBadQuotes is a value with an unterminated quote.
+	KindBadQuotes
+	// KindBadDirective is a directive that strict resolving rejects: unknown
+	// or unsupported, with the wrong number of arguments or an invalid value.
+	KindBadDirective
+)
+
+var errorKindNames = map[ErrorKind]string{
+	KindSyntax:        "syntax error",
+	KindBadPattern:    "bad pattern",
+	KindBadMatch:      "bad Match criteria",
+	KindInclude:       "include failure",
+	KindDepthExceeded: "include depth exceeded",
+	KindMissingValue:  "missing value",
+	KindIO:            "I/O error",
+	KindBadQuotes:     "invalid quotes",
+	KindBadDirective:  "bad directive",
+}
+
+func (k ErrorKind) String() string {
+	if name, ok := errorKindNames[k]; ok {
+		return name
+	}
+	return fmt.Sprintf("ErrorKind(%d)", int(k))
+}
+
+// ParseError is returned when a config file cannot be read or parsed. Errors
+// in an included file are reported with the name and position of that file.
+type ParseError struct {
+	// Filename is the file the error occurred in. It is empty for configs
+	// read with Decode or DecodeBytes.
+	Filename string
+	// Position is the position of the offending value. It is invalid for
+	// I/O errors.
+	Position Position
+	Kind     ErrorKind
+	// Err is the underlying error.
+	Err error
+}
+
+// Error returns the error as "file:line:col: message", or "(line, col):
+// message" if e has no Filename.
+func (e *ParseError) Error() string {
+	switch {
+	case e.Filename != "" && !e.Position.Invalid():
+		return fmt.Sprintf("%s:%d:%d: %v", e.Filename, e.Position.Line, e.Position.Col, e.Err)
+	case e.Filename != "":
+		return fmt.Sprintf("%s: %v", e.Filename, e.Err)
+	case !e.Position.Invalid():
+		return e.Position.String() + ": " + e.Err.Error()
+	}
+	return e.Err.Error()
+}
+
+// Unwrap returns e.Err.
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// ioError wraps an error reading filename. The file name of an *fs.PathError
+// is dropped since it is already in the ParseError.
+func ioError(filename string, err error) *ParseError {
+	var pathErr *fs.PathError
+	if filename != "" && errors.As(err, &pathErr) && pathErr.Path == filename {
+		err = pathErr.Err
+	}
+	return &ParseError{Filename: filename, Kind: KindIO, Err: err}
+}
+
+// ParseErrors is the error returned by tolerant decoding: every error found,
+// in the order they were found.
+type ParseErrors []*ParseError
+
+// Error returns the first error and the number of other errors.
+func (e ParseErrors) Error() string {
+	switch len(e) {
+	case 0:
+		return "ssh_config: no errors"
+	case 1:
+		return e[0].Error()
+	case 2:
+		return e[0].Error() + " (and 1 more error)"
+	}
+	return fmt.Sprintf("%s (and %d more errors)", e[0].Error(), len(e)-1)
+}
+
+// Unwrap returns the errors in e.
+func (e ParseErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i := range e {
+		errs[i] = e[i]
+	}
+	return errs
+}
+
+// setFilename sets the Filename of the ParseErrors in err that do not have
+// one.
+func setFilename(err error, filename string) {
+	switch e := err.(type) {
+	case *ParseError:
+		if e.Filename == "" {
+			e.Filename = filename
+		}
+	case ParseErrors:
+		for _, perr := range e {
+			setFilename(perr, filename)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package ssh_config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// ExecRunner runs Match exec commands through a shell, like ssh. Use its Run
+// method as Context.Exec:
+//
+//	ctx.Exec = (&ssh_config.ExecRunner{Timeout: 5 * time.Second}).Run
+//
+// A command matches if it exits with status 0. Its standard input and output
+// are discarded.
+type ExecRunner struct {
+	// Shell runs the command with "-c". If empty, /bin/sh is used.
+	Shell string
+	// Timeout bounds how long a command may run. A command that times out
+	// is killed and Run returns an error. Zero means no timeout.
+	Timeout time.Duration
+	// Env lists the names of the environment variables passed to the
+	// command, with their values from the current process, in addition to
+	// PATH. The command runs with an otherwise empty environment.
+	Env []string
+	// Stderr receives the standard error of the command. If nil, it is
+	// discarded.
+	Stderr io.Writer
+}
+
+// Run runs cmd and reports whether it exited with status 0. It returns an
+// error if the command cannot be started or times out.
+func (r *ExecRunner) Run(cmd string) (bool, error) {
+	shell := r.Shell
+	if shell == "" {
+		shell = "/bin/sh"
+	}
+	ctx := context.Background()
+	if r.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.Timeout)
+		defer cancel()
+	}
+	c := exec.CommandContext(ctx, shell, "-c", cmd)
+	c.Env = []string{}
+	for i, name := range append([]string{"PATH"}, r.Env...) {
+		if i > 0 && name == "PATH" {
+			continue
+		}
+		if val, ok := os.LookupEnv(name); ok {
+			c.Env = append(c.Env, name+"="+val)
+		}
+	}
+	c.Stderr = r.Stderr
+	// Don't wait for children of the shell that keep stderr open.
+	c.WaitDelay = 100 * time.Millisecond
+	err := c.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return false, fmt.Errorf("ssh_config: Match exec %q: timed out after %v", cmd, r.Timeout)
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("ssh_config: Match exec %q: %v", cmd, err)
+	}
+	return true, nil
+}
+
+type execResult struct {
+	ok  bool
+	err error
+}
+
+// cachedExec wraps fn so that each command runs at most once. Resolve uses
+// a new cache in each pass so a command is not run again by several Match
+// blocks of the same pass.
+func cachedExec(fn func(cmd string) (bool, error)) func(cmd string) (bool, error) {
+	cache := make(map[string]execResult)
+	return func(cmd string) (bool, error) {
+		if res, ok := cache[cmd]; ok {
+			return res.ok, res.err
+		}
+		ok, err := fn(cmd)
+		cache[cmd] = execResult{ok, err}
+		return ok, err
+	}
+}
@@ -0,0 +1,82 @@
+package ssh_config
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExecRunner(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("ExecRunner needs /bin/sh")
+	}
+	t.Setenv("SSH_CONFIG_TEST_ALLOWED", "yes")
+	t.Setenv("SSH_CONFIG_TEST_HIDDEN", "yes")
+	r := &ExecRunner{Env: []string{"SSH_CONFIG_TEST_ALLOWED"}}
+	tests := []struct {
+		cmd  string
+		want bool
+	}{
+		{"true", true},
+		{"false", false},
+		{"exit 3", false},
+		{`test "$SSH_CONFIG_TEST_ALLOWED" = yes`, true},
+		{`test -z "$SSH_CONFIG_TEST_HIDDEN"`, true},
+		{`test -n "$PATH"`, true},
+	}
+	for _, tt := range tests {
+		got, err := r.Run(tt.cmd)
+		if err != nil {
+			t.Errorf("Run(%q): %v", tt.cmd, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Run(%q) got %v, want %v", tt.cmd, got, tt.want)
+		}
+	}
+
+	r = &ExecRunner{Timeout: 20 * time.Millisecond}
+	start := time.Now()
+	if _, err := r.Run("sleep 5"); err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("expected timeout error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("timed out command took %v", elapsed)
+	}
+
+	r = &ExecRunner{Shell: "/nonexistent/shell"}
+	if _, err := r.Run("true"); err == nil {
+		t.Error("expected error for a missing shell")
+	}
+}
+
+func TestResolveMatchExecCached(t *testing.T) {
+	input := "Match exec \"check %h\"\n  User first\nMatch exec \"check %h\"\n  Port 2222\nMatch final exec \"check %h\"\n  IdentityFile /k\n"
+	cfg, err := Decode(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	var calls []string
+	ctx := Context{HostArg: "web", LocalUser: "local", Exec: func(cmd string) (bool, error) {
+		calls = append(calls, cmd)
+		return true, nil
+	}}
+	res, err := cfg.Resolve(ctx, FinalPass())
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	// Once in the initial pass and once in the final pass.
+	if len(calls) != 2 || calls[0] != "check web" || calls[1] != "check web" {
+		t.Errorf("Exec calls got %q, want one call per pass", calls)
+	}
+	if res.Get("User") != "first" || res.Get("Port") != "2222" || res.Get("IdentityFile") != "/k" {
+		t.Errorf("got User %q, Port %q, IdentityFile %q", res.Get("User"), res.Get("Port"), res.Get("IdentityFile"))
+	}
+	if _, err := cfg.Resolve(ctx); err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if len(calls) != 3 {
+		t.Errorf("expected a new Resolve call to run the command again, got %d calls", len(calls))
+	}
+}
@@ -0,0 +1,315 @@
+package ssh_config
+
+import (
+	"fmt"
+	"os"
+	osuser "os/user"
+	"strings"
+)
+
+// hostNameTokens are the tokens accepted by HostName, which are expanded
+// against the host argument rather than the resolved HostName.
+var hostNameTokens = []string{"%%", "%h"}
+
+// allTokens is the token set used by directives that accept all tokens, such
+// as LocalCommand.
+var allTokens = []string{
+	"%%", "%C", "%d", "%f", "%H", "%h", "%I", "%i", "%j", "%K", "%k",
+	"%L", "%l", "%n", "%p", "%r", "%T", "%t", "%u",
+}
+
+func hostNameTokenValues(ctx Context) map[string]string {
+	return map[string]string{
+		"%%": "%",
+		"%h": ctx.HostArg,
+	}
+}
+
+// percentTokens returns the values of the tokens that are known once the
+// configuration has been resolved. Tokens that describe a connection in
+// progress, such as the host key offered by the server (%K), are absent.
+func percentTokens(ctx Context, values map[string][]string, spec *clientSpec) map[string]string {
+	localHost, _ := os.Hostname()
+	shortHost := localHost
+	if idx := strings.Index(localHost, "."); idx > 0 {
+		shortHost = localHost[:idx]
+	}
+	port := resolvePort(values, spec)
+	remote := remoteUser(ctx, values)
+	jump := firstValue(values, "proxyjump")
+	if strings.EqualFold(jump, "none") {
+		jump = ""
+	}
+	host := effectiveHost(ctx, values)
+	keyAlias := firstValue(values, "hostkeyalias")
+	if keyAlias == "" {
+		keyAlias = host
+	}
+	tunnel := "NONE"
+	if t := firstValue(values, "tunnel"); t != "" && !strings.EqualFold(t, "no") && !strings.EqualFold(t, "false") {
+		tunnel = firstValue(values, "tunneldevice")
+	}
+	return map[string]string{
+		"%%": "%",
+		"%C": connectionHash(localHost, host, port, remote, jump),
+		"%L": shortHost,
+		"%d": ctx.HomeDir,
+		"%h": host,
+		"%k": keyAlias,
+		"%l": localHost,
+		"%n": ctx.OriginalHost,
+		"%p": port,
+		"%r": remote,
+		"%u": ctx.LocalUser,
+		"%i": currentUID(),
+		"%j": jump,
+		"%T": tunnel,
+	}
+}
+
+// percentExpand replaces the tokens in value. Like ssh, it fails on tokens
+// that are not in allowed, and on a trailing '%'.
+func percentExpand(value string, allowed []string, values map[string]string) (string, error) {
+	return dollarPercentExpand(value, allowed, values, nil)
+}
+
+// dollarPercentExpand replaces ${VAR} references using lookupEnv, if it is not
+// nil, and percent tokens, if allowed is not nil, in a single pass: the
+// replacement text is not expanded again. Like ssh, it fails on undefined
+// environment variables.
+func dollarPercentExpand(value string, allowed []string, values map[string]string, lookupEnv func(string) (string, bool)) (string, error) {
+	if strings.IndexByte(value, '%') < 0 && (lookupEnv == nil || !strings.Contains(value, "${")) {
+		return value, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if lookupEnv != nil && strings.HasPrefix(value[i:], "${") {
+			end := strings.IndexByte(value[i+2:], '}')
+			if end < 0 {
+				return "", fmt.Errorf("environment variable %q missing closing '}'", value[i:])
+			}
+			name := value[i+2 : i+2+end]
+			if name == "" {
+				return "", fmt.Errorf("zero-length environment variable in %q", value)
+			}
+			val, ok := lookupEnv(name)
+			if !ok {
+				return "", fmt.Errorf("environment variable ${%s} is not set", name)
+			}
+			b.WriteString(val)
+			i += end + 2
+			continue
+		}
+		if value[i] != '%' || allowed == nil {
+			b.WriteByte(value[i])
+			continue
+		}
+		if i+1 >= len(value) {
+			return "", fmt.Errorf("invalid format %q: trailing %%", value)
+		}
+		token := value[i : i+2]
+		if !containsToken(allowed, token) {
+			return "", fmt.Errorf("unknown token %s in %q", token, value)
+		}
+		repl, ok := values[token]
+		if !ok {
+			return "", fmt.Errorf("token %s in %q is only known while connecting", token, value)
+		}
+		b.WriteString(repl)
+		i++
+	}
+	return b.String(), nil
+}
+
+func containsToken(tokens []string, token string) bool {
+	for _, t := range tokens {
+		if t == token {
+			return true
+		}
+	}
+	return false
+}
+
+// lookupDirective returns the spec entry for key, following aliases.
+func (s *clientSpec) lookupDirective(key string) *specDirective {
+	d := s.byName[strings.ToLower(key)]
+	for i := 0; d != nil && d.AliasFor != "" && i < 4; i++ {
+		next := s.byName[strings.ToLower(d.AliasFor)]
+		if next == nil {
+			break
+		}
+		d = next
+	}
+	return d
+}
+
+// GetExpanded returns the effective value for key with percent tokens and,
+// for directives that support them, ${VAR} environment references expanded,
+// as ssh would use it. Only the tokens documented for the directive are
+// accepted, and referencing an undefined environment variable is an error.
+// Directives that do not accept tokens are returned unchanged. It returns an
+// empty string if key has no value.
+func (r *Result) GetExpanded(key string) (string, error) {
+	vals, err := r.GetAllExpanded(key)
+	if err != nil || len(vals) == 0 {
+		return "", err
+	}
+	return vals[0], nil
+}
+
+// GetAllExpanded returns all effective values for key with percent tokens and
+// environment variables expanded. See GetExpanded.
+func (r *Result) GetAllExpanded(key string) ([]string, error) {
+	vals, err := r.rawExpanded(key)
+	if err != nil {
+		return nil, err
+	}
+	return r.unquoted(key, vals), nil
+}
+
+// rawExpanded returns the raw values for key, as rawValues does, with tokens
+// and environment variables expanded.
+func (r *Result) rawExpanded(key string) ([]string, error) {
+	vals := r.rawValues(key)
+	if len(vals) == 0 || r.spec == nil {
+		return vals, nil
+	}
+	d := r.spec.lookupDirective(key)
+	if d == nil {
+		return vals, nil
+	}
+	for i := range vals {
+		expanded, err := r.expand(d, vals[i])
+		if err != nil {
+			return nil, fmt.Errorf("ssh_config: %s: %v", key, err)
+		}
+		vals[i] = expanded
+	}
+	return vals, nil
+}
+
+func (r *Result) expand(d *specDirective, value string) (string, error) {
+	var allowed []string
+	var tokens map[string]string
+	switch {
+	case strings.EqualFold(d.Canonical, "hostname"):
+		allowed, tokens = hostNameTokens, hostNameTokenValues(r.ctx)
+	case d.TokensAll:
+		allowed = allTokens
+	case len(d.Tokens) > 0:
+		allowed = d.Tokens
+	case !d.Env:
+		return value, nil
+	}
+	if tokens == nil && allowed != nil {
+		tokens = percentTokens(r.ctx, r.values, r.spec)
+	}
+	var lookupEnv func(string) (string, bool)
+	if d.Env {
+		lookupEnv = r.ctx.LookupEnv
+		if lookupEnv == nil {
+			lookupEnv = os.LookupEnv
+		}
+	}
+	if !d.EnvUnixPaths {
+		return dollarPercentExpand(value, allowed, tokens, lookupEnv)
+	}
+	// Only the Unix domain socket paths of a forwarding are expanded.
+	fields := splitArgs(value)
+	for i, field := range fields {
+		if !strings.Contains(field, "/") {
+			continue
+		}
+		expanded, err := dollarPercentExpand(field, allowed, tokens, lookupEnv)
+		if err != nil {
+			return "", err
+		}
+		fields[i] = expanded
+	}
+	return joinArgs(fields), nil
+}
+
+// tildeDirectives are the directives in which ssh expands ~ and ~user.
+var tildeDirectives = []string{
+	"certificatefile",
+	"controlpath",
+	"identityagent",
+	"identityfile",
+	"revokedhostkeys",
+	"userknownhostsfile",
+}
+
+// lookupUserHome returns the home directory of the named user. It is a
+// variable so tests can replace it.
+var lookupUserHome = func(name string) (string, error) {
+	usr, err := osuser.Lookup(name)
+	if err != nil {
+		return "", err
+	}
+	return usr.HomeDir, nil
+}
+
+// expandTilde replaces a leading ~ or ~user in path with the matching home
+// directory, like ssh's tilde_expand_filename.
+func expandTilde(path, home string) (string, error) {
+	if !strings.HasPrefix(path, "~") {
+		return path, nil
+	}
+	name, rest := path[1:], ""
+	if idx := strings.IndexByte(name, '/'); idx >= 0 {
+		name, rest = name[:idx], name[idx+1:]
+	}
+	dir := home
+	if name != "" {
+		var err error
+		dir, err = lookupUserHome(name)
+		if err != nil {
+			return "", fmt.Errorf("no such user %q", name)
+		}
+	}
+	if rest == "" {
+		return dir, nil
+	}
+	return strings.TrimSuffix(dir, "/") + "/" + rest, nil
+}
+
+// expandTildes expands ~ in the resolved values of path directives. In strict
+// mode an unknown ~user is an error; otherwise the value is left unchanged.
+func expandTildes(state *resolveState, ctx Context, options resolveOptions) error {
+	for _, key := range tildeDirectives {
+		vals := state.values[key]
+		for i, val := range vals {
+			var expanded string
+			var err error
+			if key == "userknownhostsfile" {
+				expanded, err = expandTildeFields(val, ctx.HomeDir)
+			} else {
+				expanded, err = expandTilde(val, ctx.HomeDir)
+			}
+			if err != nil {
+				if options.strict {
+					return fmt.Errorf("ssh_config: %s: %s: %v", state.origins[key][i], key, err)
+				}
+				continue
+			}
+			vals[i] = expanded
+		}
+	}
+	return nil
+}
+
+// expandTildeFields expands ~ in each path of a list of arguments.
+func expandTildeFields(value, home string) (string, error) {
+	if !strings.Contains(value, "~") {
+		return value, nil
+	}
+	fields := splitArgs(value)
+	for i := range fields {
+		expanded, err := expandTilde(fields[i], home)
+		if err != nil {
+			return "", err
+		}
+		fields[i] = expanded
+	}
+	return joinArgs(fields), nil
+}
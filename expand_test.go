@@ -0,0 +1,261 @@
+package ssh_config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func resolveString(t *testing.T, input string, ctx Context, opts ...ResolveOption) *Result {
+	t.Helper()
+	cfg, err := Decode(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	res, err := cfg.Resolve(ctx, opts...)
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	return res
+}
+
+func TestGetExpanded(t *testing.T) {
+	input := `Host db
+  HostName %h.internal
+  User bob
+  Port 2222
+  IdentityFile /keys/%r@%h-%p
+  IdentityFile /keys/%n
+  ControlPath /tmp/%C
+  LocalForward /tmp/%r.sock localhost:80
+  LocalCommand echo %T %%
+  SetEnv FOO=%h
+`
+	res := resolveString(t, input, Context{HostArg: "db", LocalUser: "local"})
+
+	tests := []struct {
+		key  string
+		want []string
+	}{
+		{"HostName", []string{"db.internal"}},
+		{"IdentityFile", []string{"/keys/bob@db.internal-2222", "/keys/db"}},
+		{"LocalForward", []string{"/tmp/bob.sock localhost:80"}},
+		{"LocalCommand", []string{"echo NONE %"}},
+		// SetEnv does not accept tokens.
+		{"SetEnv", []string{"FOO=%h"}},
+		{"ProxyJump", nil},
+	}
+	for _, tt := range tests {
+		got, err := res.GetAllExpanded(tt.key)
+		if err != nil {
+			t.Errorf("GetAllExpanded(%q): %v", tt.key, err)
+			continue
+		}
+		if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+			t.Errorf("GetAllExpanded(%q) got %q, want %q", tt.key, got, tt.want)
+		}
+	}
+
+	localHost, _ := os.Hostname()
+	want := "/tmp/" + connectionHash(localHost, "db.internal", "2222", "bob", "")
+	if got, err := res.GetExpanded("ControlPath"); err != nil || got != want {
+		t.Errorf("ControlPath got %q, %v; want %q", got, err, want)
+	}
+	if got := res.Get("IdentityFile"); got != "/keys/%r@%h-%p" {
+		t.Errorf("Get should return the raw value, got %q", got)
+	}
+}
+
+func TestGetExpandedErrors(t *testing.T) {
+	input := `Host *
+  ProxyCommand ssh -W %h:%p %d
+  ControlPath /tmp/ssh-%
+  KnownHostsCommand /bin/check %H
+  RemoteCommand echo %x
+`
+	res := resolveString(t, input, Context{HostArg: "example.com", LocalUser: "local"})
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"ProxyCommand", "unknown token %d"},
+		{"ControlPath", "trailing %"},
+		{"KnownHostsCommand", "token %H"},
+		{"RemoteCommand", "unknown token %x"},
+	}
+	for _, tt := range tests {
+		_, err := res.GetExpanded(tt.key)
+		if err == nil {
+			t.Errorf("GetExpanded(%q): expected error", tt.key)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.want) || !strings.Contains(err.Error(), tt.key) {
+			t.Errorf("GetExpanded(%q) error got %v, want it to mention %q", tt.key, err, tt.want)
+		}
+	}
+}
+
+func TestResolveMatchExecUnknownToken(t *testing.T) {
+	cfg, err := Decode(strings.NewReader("Match exec \"echo %T\"\n  User match\n"))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	ctx := Context{HostArg: "example.com", Exec: func(string) (bool, error) { return true, nil }}
+	if _, err := cfg.Resolve(ctx, Strict()); err == nil || !strings.Contains(err.Error(), "unknown token %T") {
+		t.Fatalf("expected unknown token error, got %v", err)
+	}
+	res, err := cfg.Resolve(ctx)
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if got := res.Get("User"); got == "match" {
+		t.Fatalf("Match exec with unknown token should not match")
+	}
+}
+
+func TestGetExpandedEnv(t *testing.T) {
+	input := `Host *
+  IdentityFile ${KEYS}/%r
+  ControlPath ${UNSET}/ssh-%C
+  IdentityAgent ${EMPTY}agent.sock
+  RemoteForward /run/${APP}.sock /tmp/${APP}.sock
+  LocalForward 8080 ${APP}:80
+  User ${APP}
+`
+	env := map[string]string{"KEYS": "/srv/keys", "APP": "web", "EMPTY": ""}
+	res := resolveString(t, input, Context{
+		HostArg:   "example.com",
+		LocalUser: "local",
+		LookupEnv: func(key string) (string, bool) {
+			v, ok := env[key]
+			return v, ok
+		},
+	})
+	tests := []struct {
+		key  string
+		want string
+	}{
+		// %r expands to the raw User value, which is not expanded again.
+		{"IdentityFile", "/srv/keys/${APP}"},
+		{"IdentityAgent", "agent.sock"},
+		// Forwards only expand Unix domain socket paths.
+		{"RemoteForward", "/run/web.sock /tmp/web.sock"},
+		{"LocalForward", "8080 ${APP}:80"},
+		// User is not flagged for environment expansion.
+		{"User", "${APP}"},
+	}
+	for _, tt := range tests {
+		got, err := res.GetExpanded(tt.key)
+		if err != nil {
+			t.Errorf("GetExpanded(%q): %v", tt.key, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("GetExpanded(%q) got %q, want %q", tt.key, got, tt.want)
+		}
+	}
+	if _, err := res.GetExpanded("ControlPath"); err == nil || !strings.Contains(err.Error(), "${UNSET} is not set") {
+		t.Errorf("expected undefined variable error, got %v", err)
+	}
+}
+
+func TestDollarPercentExpandSinglePass(t *testing.T) {
+	got, err := dollarPercentExpand("${A}-%h", []string{"%h"}, map[string]string{"%h": "${A}"}, func(string) (string, bool) {
+		return "%h", true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "%h-${A}" {
+		t.Errorf("got %q, want %q", got, "%h-${A}")
+	}
+	if _, err := dollarPercentExpand("${A", nil, nil, func(string) (string, bool) { return "", true }); err == nil {
+		t.Error("expected error for unterminated variable")
+	}
+	if _, err := dollarPercentExpand("${}", nil, nil, func(string) (string, bool) { return "", true }); err == nil {
+		t.Error("expected error for empty variable name")
+	}
+}
+
+func TestResolveTildeExpansion(t *testing.T) {
+	old := lookupUserHome
+	lookupUserHome = func(name string) (string, error) {
+		if name == "deploy" {
+			return "/srv/deploy/", nil
+		}
+		return "", errors.New("unknown user")
+	}
+	defer func() { lookupUserHome = old }()
+
+	input := "Host *\n  IdentityFile ~/.ssh/id_work\n  IdentityFile ~deploy/.ssh/id_deploy\n  UserKnownHostsFile ~/.ssh/known_hosts ~deploy/known_hosts\n  ControlPath ~\n  ProxyCommand ssh ~/bin\n"
+	res := resolveString(t, input, Context{HostArg: "web", LocalUser: "local", HomeDir: "/home/fixture"})
+	tests := []struct {
+		key  string
+		want []string
+	}{
+		{"IdentityFile", []string{"/home/fixture/.ssh/id_work", "/srv/deploy/.ssh/id_deploy"}},
+		{"UserKnownHostsFile", []string{"/home/fixture/.ssh/known_hosts /srv/deploy/known_hosts"}},
+		{"ControlPath", []string{"/home/fixture"}},
+		{"ProxyCommand", []string{"ssh ~/bin"}},
+	}
+	for _, tt := range tests {
+		got := res.GetAll(tt.key)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("GetAll(%q) got %q, want %q", tt.key, got, tt.want)
+		}
+	}
+	if got, _ := res.GetExpanded("IdentityFile"); got != "/home/fixture/.ssh/id_work" {
+		t.Errorf("GetExpanded(IdentityFile) got %q", got)
+	}
+
+	cfg, err := Decode(strings.NewReader("Host *\n  IdentityFile ~nobody/id\n"))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	res, err = cfg.Resolve(Context{HostArg: "web", HomeDir: "/home/fixture"})
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if got := res.Get("IdentityFile"); got != "~nobody/id" {
+		t.Errorf("IdentityFile got %q, want it unchanged", got)
+	}
+	_, err = cfg.Resolve(Context{HostArg: "web", HomeDir: "/home/fixture"}, Strict())
+	if err == nil || !strings.Contains(err.Error(), `no such user "nobody"`) {
+		t.Errorf("expected unknown user error, got %v", err)
+	}
+}
+
+func TestIncludeHomeDir(t *testing.T) {
+	home := t.TempDir()
+	sshDir := filepath.Join(home, ".ssh")
+	if err := os.Mkdir(sshDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"config":   "Include ~/.ssh/tilde\nInclude relative\n",
+		"tilde":    "Host tilde\n  Port 2201\n",
+		"relative": "Host relative\n  Port 2202\n  ControlPath %d/cm\n",
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(sshDir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	us := &UserSettings{
+		HomeDir:            home,
+		systemConfigFinder: nullConfigFinder,
+	}
+	if got := resolveUserSettings(t, us, "tilde").Get("Port"); got != "2201" {
+		t.Errorf("tilde Include: Port got %q, want 2201", got)
+	}
+	res := resolveUserSettings(t, us, "relative")
+	if got := res.Get("Port"); got != "2202" {
+		t.Errorf("relative Include: Port got %q, want 2202", got)
+	}
+	if got, err := res.GetExpanded("ControlPath"); err != nil || got != home+"/cm" {
+		t.Errorf("ControlPath got %q (%v), want %q", got, err, home+"/cm")
+	}
+}
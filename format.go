@@ -0,0 +1,248 @@
+package ssh_config
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// FormatOptions controls Format. The zero value formats with two spaces of
+// indentation, a space between keywords and values, keywords spelled as in
+// the ssh_config manual and a blank line between blocks.
+type FormatOptions struct {
+	// Indent is the indentation of the lines in Host and Match blocks, such
+	// as "\t" or four spaces. If empty, two spaces are used, unless NoIndent
+	// is set.
+	Indent string
+	// NoIndent writes the lines in Host and Match blocks without indentation.
+	// Indent is ignored.
+	NoIndent bool
+	// Equals separates keywords from their values with " = " instead of a
+	// space. Host, Match and Include lines always use a space.
+	Equals bool
+	// KeepCase keeps keywords as written instead of spelling them as in the
+	// ssh_config manual, such as IdentityFile.
+	KeepCase bool
+	// AlignComments lines up the trailing comments of the directives of each
+	// block in one column. Otherwise a single space precedes them.
+	AlignComments bool
+	// Compact removes blank lines, including those between blocks.
+	Compact bool
+}
+
+// Format returns cfg in a consistent style: the indentation, keyword
+// spelling, separators, comment spacing and blank lines are normalized
+// according to opts, and line endings become "\n". Comments stay on their
+// lines, and the leading comments of a Host or Match line are not indented.
+// Values are kept as written, except that Host patterns, Match
+// criteria and Include paths are respaced. Lines kept by tolerant decoding
+// are written unchanged. cfg itself is not modified.
+func Format(cfg *Config, opts FormatOptions) []byte {
+	switch {
+	case opts.NoIndent:
+		opts.Indent = ""
+	case opts.Indent == "":
+		opts.Indent = "  "
+	}
+	f := formatter{opts: opts}
+	out := Config{bom: cfg.bom}
+	for _, block := range cfg.effectiveBlocks() {
+		if isEmptyImplicit(block) && len(leadingComments(block)) == 0 {
+			continue
+		}
+		out.Blocks = append(out.Blocks, f.block(block, len(out.Blocks) > 0))
+	}
+	return marshal(out).Bytes()
+}
+
+type formatter struct {
+	opts FormatOptions
+}
+
+// keyword returns key spelled as in the ssh_config manual, unless the
+// options say otherwise or key is not in the spec.
+func (f *formatter) keyword(key string) string {
+	if f.opts.KeepCase {
+		return key
+	}
+	spec, err := loadClientSpec()
+	if err != nil {
+		return key
+	}
+	if d := spec.byName[strings.ToLower(key)]; d != nil && d.Display != "" {
+		return d.Display
+	}
+	return key
+}
+
+// commentSpace returns the space before a trailing comment, if there is one.
+func commentSpace(text string, format lineFormat) string {
+	if text == "" && !format.emptyComment {
+		return ""
+	}
+	return " "
+}
+
+// block returns a formatted copy of b. Its leading comments are not
+// indented, and follow a blank line if another block comes before it.
+func (f *formatter) block(b Block, after bool) Block {
+	lines := lineState{blank: after && !f.opts.Compact, started: after}
+	switch b := b.(type) {
+	case *Host:
+		h := *b
+		h.LeadingComments = f.comments(&lines, b.LeadingComments, "")
+		lines.flush(&h.LeadingComments)
+		h.lineFormat = lineFormat{emptyComment: b.emptyComment}
+		h.keyword = f.keyword(keywordOr(b.keyword, "Host"))
+		h.hasEquals = false
+		h.spaceBeforeComment = commentSpace(b.EOLComment, b.lineFormat)
+		h.parsedPatterns = nil
+		indent := f.opts.Indent
+		if b.implicit {
+			indent = ""
+		}
+		h.Nodes = f.nodes(b.Nodes, indent)
+		return &h
+	case *Match:
+		m := *b
+		m.LeadingComments = f.comments(&lines, b.LeadingComments, "")
+		lines.flush(&m.LeadingComments)
+		m.lineFormat = lineFormat{emptyComment: b.emptyComment}
+		m.keyword = f.keyword(keywordOr(b.keyword, "Match"))
+		m.hasEquals = false
+		m.spaceBeforeComment = commentSpace(b.EOLComment, b.lineFormat)
+		if !b.invalid() {
+			m.rawCriteria = ""
+		}
+		m.Nodes = f.nodes(b.Nodes, f.opts.Indent)
+		return &m
+	}
+	return b
+}
+
+// lineState tracks the blank lines in a run of formatted lines.
+type lineState struct {
+	// blank is set if a blank line is due before the next line.
+	blank bool
+	// started is set once a line has been written, so that blank lines at
+	// the start are dropped.
+	started bool
+}
+
+// flush appends the blank line that is due, if any, to comments.
+func (s *lineState) flush(comments *[]*Empty) {
+	if s.blank {
+		*comments = append(*comments, &Empty{})
+		s.blank = false
+	}
+	s.started = true
+}
+
+// comments returns formatted copies of the comment lines in lines, indented
+// by indent. Blank lines are collapsed into one and dropped at the start.
+func (f *formatter) comments(s *lineState, lines []*Empty, indent string) []*Empty {
+	var out []*Empty
+	for _, e := range lines {
+		if e.isBlank() {
+			s.blank = s.blank || (s.started && !f.opts.Compact)
+			continue
+		}
+		c := *e
+		c.lineFormat = lineFormat{indent: indent, emptyComment: e.emptyComment}
+		s.flush(&out)
+		out = append(out, &c)
+	}
+	return out
+}
+
+// nodes returns formatted copies of nodes, without blank lines at the start
+// or end and with runs of blank lines collapsed into one.
+func (f *formatter) nodes(nodes []Node, indent string) []Node {
+	out := make([]Node, 0, len(nodes))
+	var lines lineState
+	for _, node := range nodes {
+		switch n := node.(type) {
+		case *KV:
+			kv := *n
+			kv.LeadingComments = f.comments(&lines, n.LeadingComments, indent)
+			lines.flush(&kv.LeadingComments)
+			kv.lineFormat = lineFormat{indent: indent, emptyComment: n.emptyComment}
+			kv.Key = f.keyword(n.Key)
+			kv.hasEquals = f.opts.Equals
+			kv.spaceAfterValue = commentSpace(n.Comment, n.lineFormat)
+			out = append(out, &kv)
+		case *Include:
+			inc := *n
+			inc.LeadingComments = f.comments(&lines, n.LeadingComments, indent)
+			lines.flush(&inc.LeadingComments)
+			inc.lineFormat = lineFormat{indent: indent, emptyComment: n.emptyComment}
+			inc.keyword = f.keyword(keywordOr(n.keyword, "Include"))
+			inc.hasEquals = false
+			inc.rawDirectives = ""
+			inc.spaceBeforeComment = commentSpace(n.Comment, n.lineFormat)
+			out = append(out, &inc)
+		case *Empty:
+			for _, e := range f.comments(&lines, []*Empty{n}, indent) {
+				out = append(out, e)
+			}
+		default:
+			var blank []*Empty
+			lines.flush(&blank)
+			for _, e := range blank {
+				out = append(out, e)
+			}
+			if bad, ok := node.(*BadLine); ok {
+				copied := *bad
+				copied.eol = ""
+				node = &copied
+			}
+			out = append(out, node)
+		}
+	}
+	if f.opts.AlignComments {
+		alignComments(out)
+	}
+	return out
+}
+
+// alignComments pads the directives with trailing comments in nodes so that
+// the comments start in the same column.
+func alignComments(nodes []Node) {
+	width := 0
+	for _, node := range nodes {
+		if w, ok := commentedWidth(node); ok {
+			width = max(width, w)
+		}
+	}
+	for _, node := range nodes {
+		w, ok := commentedWidth(node)
+		if !ok {
+			continue
+		}
+		pad := strings.Repeat(" ", width-w+1)
+		switch n := node.(type) {
+		case *KV:
+			n.spaceAfterValue = pad
+		case *Include:
+			n.spaceBeforeComment = pad
+		}
+	}
+}
+
+// commentedWidth returns the width of node before its trailing comment, if
+// node is a directive with a trailing comment.
+func commentedWidth(node Node) (int, bool) {
+	switch n := node.(type) {
+	case *KV:
+		if n.spaceAfterValue == "" {
+			return 0, false
+		}
+		return utf8.RuneCountInString(n.indent + n.Key + n.separator(n.hasEquals) + n.Value), true
+	case *Include:
+		if n.spaceBeforeComment == "" {
+			return 0, false
+		}
+		line := n.String()
+		return utf8.RuneCountInString(line[:len(line)-len(n.spaceBeforeComment+n.comment(n.Comment))]), true
+	}
+	return 0, false
+}
@@ -0,0 +1,82 @@
+package ssh_config
+
+import (
+	"strings"
+	"testing"
+)
+
+var formatInput = "\ufeff# global\r\ncompression=yes   # c\r\n\r\n\r\nhost  a   'b c' # hdr\r\n\tidentityfile ~/.ssh/x\r\n    PORT=22 #p\r\n\r\n\r\n  # note\r\n\r\nmatch   host=x   user y\r\n        user  bob\r\n\r\n"
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name string
+		opts FormatOptions
+		want string
+	}{
+		{"default", FormatOptions{}, "\ufeff# global\nCompression yes # c\n\nHost a \"b c\" # hdr\n  IdentityFile ~/.ssh/x\n  Port 22 #p\n\n  # note\n\nMatch host x user y\n  User bob\n"},
+		{"tabs and equals", FormatOptions{Indent: "\t", Equals: true}, "\ufeff# global\nCompression = yes # c\n\nHost a \"b c\" # hdr\n\tIdentityFile = ~/.ssh/x\n\tPort = 22 #p\n\n\t# note\n\nMatch host x user y\n\tUser = bob\n"},
+		{"no indent", FormatOptions{Indent: "\t", NoIndent: true}, "\ufeff# global\nCompression yes # c\n\nHost a \"b c\" # hdr\nIdentityFile ~/.ssh/x\nPort 22 #p\n\n# note\n\nMatch host x user y\nUser bob\n"},
+		{"keep case and compact", FormatOptions{KeepCase: true, Compact: true}, "\ufeff# global\ncompression yes # c\nhost a \"b c\" # hdr\n  identityfile ~/.ssh/x\n  PORT 22 #p\n  # note\nmatch host x user y\n  user bob\n"},
+	}
+	for _, tt := range tests {
+		cfg, err := Decode(strings.NewReader(formatInput))
+		if err != nil {
+			t.Fatalf("Decode: %v", err)
+		}
+		if got := string(Format(cfg, tt.opts)); got != tt.want {
+			t.Errorf("%s: Format() = %q, want %q", tt.name, got, tt.want)
+		}
+		if got := cfg.String(); got != formatInput {
+			t.Errorf("%s: Format modified the config: %q", tt.name, got)
+		}
+	}
+}
+
+func TestFormatAlignComments(t *testing.T) {
+	cfg, err := Decode(strings.NewReader("Host a\n  User bob # who\n  IdentityFile ~/.ssh/id # key\n  Port 22\n  Include other # more\nHost b\n  User x  # short\n"))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	want := "Host a\n  User bob               # who\n  IdentityFile ~/.ssh/id # key\n  Port 22\n  Include other          # more\n\nHost b\n  User x # short\n"
+	if got := string(Format(cfg, FormatOptions{AlignComments: true})); got != want {
+		t.Errorf("Format() = %q, want %q", got, want)
+	}
+}
+
+func TestFormatIdempotent(t *testing.T) {
+	cfg, err := Decode(strings.NewReader(formatInput))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	opts := FormatOptions{Indent: "    ", AlignComments: true}
+	once := Format(cfg, opts)
+	cfg, err = DecodeBytes(once)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if twice := Format(cfg, opts); string(twice) != string(once) {
+		t.Errorf("Format is not idempotent:\n%s\nthen\n%s", once, twice)
+	}
+}
+
+func TestFormatKeepsBadLines(t *testing.T) {
+	cfg, err := DecodeOptions{Tolerant: true}.Decode(strings.NewReader("Host a\n    User bob\n    User \"bob\n"))
+	if err == nil {
+		t.Fatal("expected a parse error")
+	}
+	want := "Host a\n  User bob\n    User \"bob\n"
+	if got := string(Format(cfg, FormatOptions{})); got != want {
+		t.Errorf("Format() = %q, want %q", got, want)
+	}
+}
+
+func TestFormatLeadingComments(t *testing.T) {
+	cfg, err := Decode(strings.NewReader("Compression yes\n\n\n# the a servers\nHost a\n\n\n    # who\n    user alice\n  # the b servers\n  Host b\n  User bob\n"))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	want := "Compression yes\n\n# the a servers\nHost a\n  # who\n  User alice\n\n# the b servers\nHost b\n  User bob\n"
+	if got := string(Format(cfg, FormatOptions{})); got != want {
+		t.Errorf("Format() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,161 @@
+package ssh_config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// lazyInclude holds what an Include decoded with DeferIncludes needs to read
+// its files when it is first resolved.
+type lazyInclude struct {
+	once sync.Once
+	opts parseOptions
+	// pos is the position of the Include value, where errors are reported.
+	pos  Position
+	errs ParseErrors
+}
+
+// read finds and parses the files matched by the directives of inc. In
+// tolerant mode it keeps going after errors and returns all of them, which
+// may include ParseErrors from included files; otherwise it stops at the
+// first error.
+func (inc *Include) read(opts parseOptions) error {
+	if opts.depth > maxRecurseDepth {
+		return ErrDepthExceeded
+	}
+	var errs []error
+	home := opts.home()
+	matches := make([]string, 0)
+	for i := range inc.directives {
+		path, err := expandTilde(inc.directives[i], home)
+		if err != nil {
+			if !opts.tolerant {
+				return err
+			}
+			errs = append(errs, err)
+			continue
+		}
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(opts.includeDir(), path)
+		}
+		theseMatches, err := opts.glob(path)
+		if err != nil {
+			if !opts.tolerant {
+				return err
+			}
+			errs = append(errs, err)
+			continue
+		}
+		matches = append(matches, theseMatches...)
+	}
+	matches = removeDups(matches)
+	inc.matches = matches
+	for i := range matches {
+		config, err := parseWithOptions(matches[i], opts)
+		if err != nil {
+			if !opts.tolerant {
+				return err
+			}
+			errs = append(errs, err)
+		}
+		if config != nil {
+			inc.files[matches[i]] = config
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// load reads the files of inc the first time it is called, if reading them
+// was deferred, and returns the errors found.
+func (inc *Include) load() ParseErrors {
+	l := inc.lazy
+	if l == nil {
+		return nil
+	}
+	l.once.Do(func() {
+		if err := inc.read(l.opts); err != nil {
+			l.errs = includeErrors(l.pos, err)
+			setFilename(l.errs, l.opts.filename)
+		}
+	})
+	return l.errs
+}
+
+// includeErrors returns err, returned by Include.read for the Include value
+// at pos, as ParseErrors. Errors in included files keep their own location.
+func includeErrors(pos Position, err error) ParseErrors {
+	switch e := err.(type) {
+	case *ParseError:
+		return ParseErrors{e}
+	case ParseErrors:
+		return e
+	case interface{ Unwrap() []error }:
+		var perrs ParseErrors
+		for _, err := range e.Unwrap() {
+			perrs = append(perrs, includeErrors(pos, err)...)
+		}
+		return perrs
+	}
+	if err == ErrDepthExceeded {
+		return ParseErrors{{Position: pos, Kind: KindDepthExceeded, Err: err}}
+	}
+	return ParseErrors{{Position: pos, Kind: KindInclude, Err: fmt.Errorf("Error parsing Include directive: %w", err)}}
+}
+
+// includeDir returns the directory that relative Include paths are resolved
+// against.
+func (o parseOptions) includeDir() string {
+	switch {
+	case o.baseDir != "":
+		return o.baseDir
+	case o.system:
+		return "/etc/ssh"
+	}
+	return filepath.Join(o.home(), ".ssh")
+}
+
+// fsPath returns the path in o.fsys of the absolute path name.
+func fsPath(name string) string {
+	name = path.Clean(filepath.ToSlash(name))
+	if name == "/" {
+		return "."
+	}
+	return strings.TrimPrefix(name, "/")
+}
+
+// readFile reads the file name from o.fsys, or from the operating system if
+// it is nil.
+func (o parseOptions) readFile(name string) ([]byte, error) {
+	if o.fsys == nil {
+		return os.ReadFile(name)
+	}
+	b, err := fs.ReadFile(o.fsys, fsPath(name))
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		// Report the name the config used, not the path in the FS.
+		pathErr.Path = name
+	}
+	return b, err
+}
+
+// glob returns the files that match pattern in o.fsys, or in the operating
+// system if it is nil, as absolute paths.
+func (o parseOptions) glob(pattern string) ([]string, error) {
+	if o.fsys == nil {
+		return filepath.Glob(pattern)
+	}
+	matches, err := fs.Glob(o.fsys, fsPath(pattern))
+	if err != nil {
+		return nil, err
+	}
+	for i, m := range matches {
+		matches[i] = "/" + m
+	}
+	return matches, nil
+}
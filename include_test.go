@@ -0,0 +1,102 @@
+package ssh_config
+
+import (
+	"errors"
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+var includeFS = fstest.MapFS{
+	"home/me/.ssh/conf.d/a.conf": {Data: []byte("Host a\n  Port 2201\n")},
+	"home/me/.ssh/conf.d/b.conf": {Data: []byte("Host b\n  Port 2202\n")},
+	"home/me/.ssh/tilde":         {Data: []byte("Host tilde\n  Port 2203\n")},
+	"etc/ssh/shared":             {Data: []byte("Host shared\n  Port 2204\n")},
+	"home/me/.ssh/bad":           {Data: []byte("Host bad\n  User \"bob\n")},
+}
+
+// countingFS counts the files opened in an fs.FS.
+type countingFS struct {
+	fs.FS
+	opened int
+}
+
+func (c *countingFS) Open(name string) (fs.File, error) {
+	c.opened++
+	return c.FS.Open(name)
+}
+
+func TestIncludeFS(t *testing.T) {
+	cfg, err := DecodeOptions{
+		FS:      includeFS,
+		BaseDir: "/home/me/.ssh",
+		HomeDir: "/home/me",
+	}.Decode(strings.NewReader("Include conf.d/*.conf ~/.ssh/tilde /etc/ssh/shared missing\n"))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	for host, port := range map[string]string{"a": "2201", "b": "2202", "tilde": "2203", "shared": "2204"} {
+		res, err := cfg.Resolve(Context{HostArg: host})
+		if err != nil {
+			t.Fatalf("Resolve(%s): %v", host, err)
+		}
+		if got := res.Get("Port"); got != port {
+			t.Errorf("%s: Port = %q, want %s", host, got, port)
+		}
+	}
+	res, err := cfg.Resolve(Context{HostArg: "a"})
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if origin, _ := res.Origin("Port"); origin.Filename != "/home/me/.ssh/conf.d/a.conf" {
+		t.Errorf("Port origin = %q, want the path of the included file", origin.Filename)
+	}
+
+	_, err = DecodeOptions{FS: includeFS, BaseDir: "/home/me/.ssh"}.Decode(strings.NewReader("Include bad\n"))
+	var perr *ParseError
+	if !errors.As(err, &perr) || perr.Filename != "/home/me/.ssh/bad" || perr.Kind != KindBadQuotes {
+		t.Errorf("expected a KindBadQuotes error in /home/me/.ssh/bad, got %v", err)
+	}
+}
+
+func TestDeferIncludes(t *testing.T) {
+	fsys := &countingFS{FS: includeFS}
+	opts := DecodeOptions{FS: fsys, BaseDir: "/home/me/.ssh", DeferIncludes: true}
+	cfg, err := opts.Decode(strings.NewReader("Host a\n  Include conf.d/*.conf\nInclude bad\n"))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if fsys.opened != 0 {
+		t.Errorf("Decode opened %d files, want none", fsys.opened)
+	}
+
+	_, err = cfg.Resolve(Context{HostArg: "a"})
+	var perr *ParseError
+	if !errors.As(err, &perr) || perr.Filename != "/home/me/.ssh/bad" || perr.Kind != KindBadQuotes {
+		t.Errorf("Resolve: expected a KindBadQuotes error in /home/me/.ssh/bad, got %v", err)
+	}
+	if err := cfg.Validate(); !errors.As(err, &perr) || perr.Kind != KindBadQuotes {
+		t.Errorf("Validate: expected a KindBadQuotes error, got %v", err)
+	}
+
+	opts.Tolerant = true
+	cfg, err = opts.Decode(strings.NewReader("Host a\n  Include conf.d/*.conf\nInclude bad\n"))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	res, err := cfg.Resolve(Context{HostArg: "a"})
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if got := res.Get("Port"); got != "2201" {
+		t.Errorf("Port = %q, want 2201", got)
+	}
+	opened := fsys.opened
+	if _, err := cfg.Resolve(Context{HostArg: "b"}); err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if fsys.opened != opened {
+		t.Errorf("the second Resolve opened %d more files, want none", fsys.opened-opened)
+	}
+}
@@ -18,10 +18,14 @@ func parseMacros(files map[string][]byte) macroResolver {
 		scanner := bufio.NewScanner(bytes.NewReader(data))
 		for scanner.Scan() {
 			line := strings.TrimSpace(scanner.Text())
-			if !strings.HasPrefix(line, "#define ") {
+			if !strings.HasPrefix(line, "#define") {
 				continue
 			}
-			line = strings.TrimPrefix(line, "#define ")
+			line = strings.TrimPrefix(line, "#define")
+			if line == "" || (line[0] != ' ' && line[0] != '\t') {
+				continue
+			}
+			line = strings.TrimSpace(line)
 			parts := strings.Fields(line)
 			if len(parts) < 2 {
 				continue
@@ -149,7 +149,7 @@ func parseOpcodeInfos(readconf string) (map[string]opcodeInfo, error) {
 			applyOpcodeInfo(infos, active, func(info *opcodeInfo) { info.ValueType = "uint" })
 		}
 		if strings.Contains(trim, "goto parse_time") {
-			applyOpcodeInfo(infos, active, func(info *opcodeInfo) { info.ValueType = "string" })
+			applyOpcodeInfo(infos, active, func(info *opcodeInfo) { info.ValueType = "time" })
 		}
 		if strings.Contains(trim, "goto parse_string") {
 			applyOpcodeInfo(infos, active, func(info *opcodeInfo) { info.ValueType = "string" })
@@ -161,10 +161,10 @@ func parseOpcodeInfos(readconf string) (map[string]opcodeInfo, error) {
 			applyOpcodeInfo(infos, active, func(info *opcodeInfo) { info.ValueType = "list" })
 		}
 		if strings.Contains(trim, "goto parse_pubkey_algos") {
-			applyOpcodeInfo(infos, active, func(info *opcodeInfo) { info.ValueType = "list" })
+			applyOpcodeInfo(infos, active, func(info *opcodeInfo) { info.ValueType = "commalist" })
 		}
 		if strings.Contains(trim, "parse_forward(") || strings.Contains(trim, "add_local_forward") || strings.Contains(trim, "add_remote_forward") {
-			applyOpcodeInfo(infos, active, func(info *opcodeInfo) { info.ValueType = "list" })
+			applyOpcodeInfo(infos, active, func(info *opcodeInfo) { info.ValueType = "forward" })
 		}
 		if m := multistateRe.FindStringSubmatch(trim); m != nil {
 			applyOpcodeInfo(infos, active, func(info *opcodeInfo) { info.Multistate = m[1] })
@@ -339,12 +339,13 @@ func defaultValue(expr string, d DirectiveSpec, info opcodeInfo, multistates map
 			return val, true
 		}
 	}
-	if d.Type == "uint" {
+	if d.Type == "uint" || d.Type == "port" {
 		if isNumber(resolved) {
 			return resolved, true
 		}
 	}
-	if d.Type == "string" || d.Type == "list" {
+	switch d.Type {
+	case "string", "list", "commalist", "time", "bytes", "enumpath", "forward":
 		if resolved != expr && resolved != "" {
 			return resolved, true
 		}
@@ -16,10 +16,13 @@ type Spec struct {
 
 type DirectiveSpec struct {
 	Name         string   `json:"name"`
+	Display      string   `json:"display,omitempty"`
 	Canonical    string   `json:"canonical"`
 	Status       string   `json:"status"`
 	Type         string   `json:"type"`
 	Multi        bool     `json:"multi"`
+	MinArgs      int      `json:"minArgs"`
+	MaxArgs      int      `json:"maxArgs"`
 	Default      any      `json:"default,omitempty"`
 	AliasFor     string   `json:"aliasFor,omitempty"`
 	Enum         []string `json:"enum,omitempty"`
@@ -87,6 +90,7 @@ func Generate(openSSHDir string) (*Spec, error) {
 	if err != nil {
 		return nil, err
 	}
+	displayNames := parseDisplayNames(string(manBytes))
 
 	canonicalByOpcode := make(map[string]string)
 	multiKeywords := map[string]bool{
@@ -113,18 +117,6 @@ func Generate(openSSHDir string) (*Spec, error) {
 
 	openSSHVersion := resolveMacroString(macros, "SSH_RELEASE")
 	defaultPort := resolveMacroString(macros, "SSH_DEFAULT_PORT")
-	algoDefaults := map[string]string{
-		"ciphers":                     "KEX_CLIENT_ENCRYPT",
-		"macs":                        "KEX_CLIENT_MAC",
-		"kexalgorithms":               "KEX_CLIENT_KEX",
-		"hostbasedacceptedalgorithms": "KEX_DEFAULT_PK_ALG",
-		"pubkeyacceptedalgorithms":    "KEX_DEFAULT_PK_ALG",
-		"casignaturealgorithms":       "SSH_ALLOWED_CA_SIGALGS",
-	}
-	typeOverrides := map[string]string{
-		"port": "uint",
-	}
-
 	directives := make([]DirectiveSpec, 0, len(keywords))
 	for _, kw := range keywords {
 		info := opcodeInfos[kw.Opcode]
@@ -134,14 +126,19 @@ func Generate(openSSHDir string) (*Spec, error) {
 		}
 		d := DirectiveSpec{
 			Name:      kw.Name,
+			Display:   displayNames[kw.Name],
 			Canonical: canonicalByOpcode[kw.Opcode],
 			Status:    kw.Status,
 			Type:      info.ValueType,
 			Multi:     info.Multi,
 		}
-		if override, ok := typeOverrides[d.Name]; ok {
+		if override, ok := typeOverrides[canonicalByOpcode[kw.Opcode]]; ok {
 			d.Type = override
 		}
+		if enum, ok := enumOverrides[canonicalByOpcode[kw.Opcode]]; ok {
+			d.Enum = enum
+		}
+		d.MinArgs, d.MaxArgs = argCounts(d.Canonical, d.Type)
 		if d.Name != d.Canonical {
 			d.AliasFor = d.Canonical
 		}
@@ -199,6 +196,84 @@ func Generate(openSSHDir string) (*Spec, error) {
 	return spec, nil
 }
 
+// algoDefaults are the macros in myproposal.h that hold the default lists of
+// the algorithm directives.
+var algoDefaults = map[string]string{
+	"ciphers":                     "KEX_CLIENT_ENCRYPT",
+	"macs":                        "KEX_CLIENT_MAC",
+	"kexalgorithms":               "KEX_CLIENT_KEX",
+	"hostkeyalgorithms":           "KEX_DEFAULT_PK_ALG",
+	"hostbasedacceptedalgorithms": "KEX_DEFAULT_PK_ALG",
+	"pubkeyacceptedalgorithms":    "KEX_DEFAULT_PK_ALG",
+	"casignaturealgorithms":       "SSH_ALLOWED_CA_SIGALGS",
+}
+
+// typeOverrides are the types of directives that readconf.c parses inline
+// rather than through one of the shared parse_* labels. A list takes several
+// arguments and a commalist a single comma-separated argument.
+var typeOverrides = map[string]string{
+	"canonicaldomains":            "list",
+	"canonicalizepermittedcnames": "list",
+	"casignaturealgorithms":       "commalist",
+	"channeltimeout":              "list",
+	"ciphers":                     "commalist",
+	"connectionattempts":          "uint",
+	"connecttimeout":              "time",
+	"controlpath":                 "enumpath",
+	"controlpersist":              "time",
+	"forwardagent":                "enumpath",
+	"globalknownhostsfile":        "list",
+	"hostkeyalgorithms":           "commalist",
+	"identityagent":               "enumpath",
+	"kexalgorithms":               "commalist",
+	"logverbose":                  "list",
+	"macs":                        "commalist",
+	"permitremoteopen":            "list",
+	"port":                        "port",
+	"preferredauthentications":    "commalist",
+	"proxyjump":                   "commalist",
+	"rekeylimit":                  "bytes",
+	"sendenv":                     "list",
+	"setenv":                      "list",
+}
+
+// enumOverrides are the keywords accepted in place of a time or path.
+var enumOverrides = map[string][]string{
+	"controlpath":    {"none"},
+	"controlpersist": {"yes", "no"},
+	"forwardagent":   {"yes", "no"},
+	"identityagent":  {"none", "SSH_AUTH_SOCK"},
+}
+
+// argOverrides are the numbers of arguments, as {min, max}, of the
+// directives that readconf.c does not parse like others of their type. A max
+// of -1 allows any number.
+var argOverrides = map[string][2]int{
+	"dynamicforward":    {1, 1},
+	"ipqos":             {1, 2},
+	"knownhostscommand": {1, -1},
+	"localcommand":      {1, -1},
+	"localforward":      {2, 2},
+	"proxycommand":      {1, -1},
+	"remotecommand":     {1, -1},
+	"versionaddendum":   {1, -1},
+}
+
+// argCounts returns the minimum and maximum number of arguments of the
+// directive canonical of type typ. A max of -1 allows any number.
+func argCounts(canonical, typ string) (min, max int) {
+	if counts, ok := argOverrides[canonical]; ok {
+		return counts[0], counts[1]
+	}
+	switch typ {
+	case "list":
+		return 1, -1
+	case "bytes", "forward":
+		return 1, 2
+	}
+	return 1, 1
+}
+
 func GenerateBytes(openSSHDir string) ([]byte, error) {
 	spec, err := Generate(openSSHDir)
 	if err != nil {
@@ -6,6 +6,7 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"strings"
 	"testing"
 )
@@ -74,6 +75,46 @@ func TestSpecMatchesFixture(t *testing.T) {
 	}
 }
 
+// TestFixtureMatchesOverrides checks, without the OpenSSH sources, that the
+// fixture is in the form GenerateBytes writes and agrees with the tables of
+// the generator. TestSpecMatchesFixture checks the rest when the sources are
+// provisioned.
+func TestFixtureMatchesOverrides(t *testing.T) {
+	fixturePath := filepath.Join(repoRoot(t), "testdata", "openssh_client_spec.json")
+	data, err := os.ReadFile(fixturePath)
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+	var spec Spec
+	if err := json.Unmarshal(data, &spec); err != nil {
+		t.Fatalf("decode fixture: %v", err)
+	}
+	got, err := json.MarshalIndent(&spec, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(bytes.TrimSpace(got), bytes.TrimSpace(data)) {
+		t.Error("spec fixture is not formatted as GenerateBytes writes it")
+	}
+	if spec.OpenSSHVersion != "OpenSSH_10.2p1" {
+		t.Errorf("fixture is for %s, want OpenSSH_10.2p1", spec.OpenSSHVersion)
+	}
+	for _, d := range spec.Directives {
+		if typ, ok := typeOverrides[d.Canonical]; ok && d.Type != typ {
+			t.Errorf("%s: type %q, want %q", d.Name, d.Type, typ)
+		}
+		if enum, ok := enumOverrides[d.Canonical]; ok && !slices.Equal(d.Enum, enum) {
+			t.Errorf("%s: enum %q, want %q", d.Name, d.Enum, enum)
+		}
+		if min, max := argCounts(d.Canonical, d.Type); d.MinArgs != min || d.MaxArgs != max {
+			t.Errorf("%s: %d to %d arguments, want %d to %d", d.Name, d.MinArgs, d.MaxArgs, min, max)
+		}
+		if _, ok := algoDefaults[d.Name]; ok && d.Name == d.Canonical && d.Default == nil {
+			t.Errorf("%s: missing default algorithm list", d.Name)
+		}
+	}
+}
+
 func TestSpecKeywordSet(t *testing.T) {
 	root := repoRoot(t)
 	opensshDir := requireOpenSSHSources(t, root, "readconf.c")
@@ -115,6 +156,18 @@ func TestSpecKeywordSet(t *testing.T) {
 	}
 }
 
+func TestParseMacrosTabSeparated(t *testing.T) {
+	macros := parseMacros(map[string][]byte{
+		"myproposal.h": []byte("#define\tKEX_SERVER_ENCRYPT \\\n\t\"aes128-ctr,\" \\\n\t\"aes256-ctr\"\n#define KEX_CLIENT_ENCRYPT KEX_SERVER_ENCRYPT\n#defineX 1\n"),
+	})
+	if got := resolveMacroString(macros, "KEX_CLIENT_ENCRYPT"); got != "aes128-ctr,aes256-ctr" {
+		t.Fatalf("KEX_CLIENT_ENCRYPT got %q", got)
+	}
+	if _, ok := macros["X"]; ok {
+		t.Fatal("#defineX should not define a macro")
+	}
+}
+
 func repoRoot(t *testing.T) string {
 	_, filename, _, ok := runtime.Caller(0)
 	if !ok {
@@ -122,3 +175,42 @@ func repoRoot(t *testing.T) string {
 	}
 	return filepath.Clean(filepath.Join(filepath.Dir(filename), "..", ".."))
 }
+
+func TestParseDisplayNames(t *testing.T) {
+	man := ".Bl -tag -width Ds\n.It Cm IdentityFile\nSpecifies a file.\n.It Cm Hostname\n.It Cm ProxyJump Xo\n.Sm off\n.It Cm identityfile\n"
+	got := parseDisplayNames(man)
+	want := map[string]string{
+		"identityfile": "IdentityFile",
+		"hostname":     "Hostname",
+		"proxyjump":    "ProxyJump",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s: got %q, want %q", k, got[k], v)
+		}
+	}
+}
+
+func TestArgCounts(t *testing.T) {
+	tests := []struct {
+		canonical, typ string
+		min, max       int
+	}{
+		{"user", "string", 1, 1},
+		{"sendenv", "list", 1, -1},
+		{"rekeylimit", "bytes", 1, 2},
+		{"remoteforward", "forward", 1, 2},
+		{"localforward", "forward", 2, 2},
+		{"dynamicforward", "forward", 1, 1},
+		{"proxycommand", "string", 1, -1},
+		{"somenewoption", "list", 1, -1},
+	}
+	for _, tt := range tests {
+		if min, max := argCounts(tt.canonical, tt.typ); min != tt.min || max != tt.max {
+			t.Errorf("argCounts(%q, %q) = %d, %d, want %d, %d", tt.canonical, tt.typ, min, max, tt.min, tt.max)
+		}
+	}
+}
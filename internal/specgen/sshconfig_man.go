@@ -140,3 +140,24 @@ func extractTokens(line string) []string {
 	}
 	return out
 }
+
+// parseDisplayNames returns the spelling of each keyword in the list of
+// keywords of ssh_config.5, such as IdentityFile, by lowercase name.
+func parseDisplayNames(man string) map[string]string {
+	names := make(map[string]string)
+	for _, line := range strings.Split(man, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, ".It Cm ") {
+			continue
+		}
+		fields := strings.Fields(strings.TrimPrefix(line, ".It Cm "))
+		if len(fields) == 0 {
+			continue
+		}
+		name := fields[0]
+		if _, ok := names[strings.ToLower(name)]; !ok {
+			names[strings.ToLower(name)] = name
+		}
+	}
+	return names
+}
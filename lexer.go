@@ -1,18 +1,29 @@
 package ssh_config
 
 import (
-	"bytes"
+	"strings"
+	"unicode/utf8"
 )
 
+const byteOrderMark = "\uFEFF"
+
 // Define state functions
 type sshLexStateFn func() sshLexStateFn
 
+// sshLexer splits a config into tokens. It is pull-based: the parser calls
+// nextToken, which runs the state functions until one of them emits a token.
+// Each state function emits at most one token.
 type sshLexer struct {
-	inputIdx int
-	input    []rune // Textual source
+	input string
+	// start is the offset of the current token in input, and idx the offset
+	// of the next rune to read.
+	start int
+	idx   int
+
+	state sshLexStateFn
+	tok   token
+	ready bool // tok holds a token that has not been returned yet
 
-	buffer        []rune // Runes composing the current token
-	tokens        chan token
 	line          int
 	col           int
 	endbufferLine int
@@ -21,16 +32,14 @@ type sshLexer struct {
 
 func (s *sshLexer) lexComment(previousState sshLexStateFn) sshLexStateFn {
 	return func() sshLexStateFn {
-		growingString := ""
 		for next := s.peek(); next != '\n' && next != eof; next = s.peek() {
 			if next == '\r' && s.follow("\r\n") {
 				break
 			}
-			growingString += string(next)
 			s.next()
 		}
-		s.emitWithValue(tokenComment, growingString)
-		s.skip()
+		s.emit(tokenComment)
+		s.skipLineEnding()
 		return previousState
 	}
 }
@@ -65,73 +74,64 @@ func (s *sshLexer) lexEquals() sshLexStateFn {
 }
 
 func (s *sshLexer) lexKey() sshLexStateFn {
-	growingString := ""
-
 	for r := s.peek(); isKeyChar(r); r = s.peek() {
 		// simplified a lot here
 		if isSpace(r) || r == '=' {
-			s.emitWithValue(tokenKey, growingString)
+			s.emit(tokenKey)
 			s.skip()
 			return s.lexEquals
 		}
-		growingString += string(r)
 		s.next()
 	}
-	s.emitWithValue(tokenKey, growingString)
+	s.emit(tokenKey)
 	return s.lexEquals
 }
 
+// lexRvalue lexes a value up to the end of the line. Like ssh, a # starts a
+// comment only at the start of an argument and outside quotes.
 func (s *sshLexer) lexRvalue() sshLexStateFn {
-	growingString := ""
+	var quote rune
+	argStart := true
 	for {
 		next := s.peek()
 		switch next {
 		case '\r':
 			if s.follow("\r\n") {
-				s.emitWithValue(tokenString, growingString)
-				s.skip()
+				s.emit(tokenString)
+				s.skipLineEnding()
 				return s.lexVoid
 			}
 		case '\n':
-			s.emitWithValue(tokenString, growingString)
-			s.skip()
+			s.emit(tokenString)
+			s.skipLineEnding()
 			return s.lexVoid
 		case '#':
-			s.emitWithValue(tokenString, growingString)
-			s.skip()
-			return s.lexComment(s.lexVoid)
+			if quote == 0 && argStart {
+				s.emit(tokenString)
+				s.skip()
+				return s.lexComment(s.lexVoid)
+			}
+		case '\\':
+			s.next()
+			if r := s.peek(); r < 0x80 && isEscapable(byte(r), byte(quote)) {
+				s.next()
+			}
+			argStart = false
+			continue
+		case '"', '\'':
+			if quote == 0 {
+				quote = next
+			} else if quote == next {
+				quote = 0
+			}
 		case eof:
 			s.next()
+			s.emit(tokenEOF)
+			return nil
 		}
-		if next == eof {
-			break
-		}
-		growingString += string(next)
+		argStart = quote == 0 && isSpace(next)
 		s.next()
 	}
-	s.emit(tokenEOF)
-	return nil
-}
-
-func (s *sshLexer) read() rune {
-	r := s.peek()
-	if r == '\n' {
-		s.endbufferLine++
-		s.endbufferCol = 1
-	} else {
-		s.endbufferCol++
-	}
-	s.inputIdx++
-	return r
-}
-
-func (s *sshLexer) next() rune {
-	r := s.read()
-
-	if r != eof {
-		s.buffer = append(s.buffer, r)
-	}
-	return r
 }
 
 func (s *sshLexer) lexVoid() sshLexStateFn {
@@ -142,35 +142,48 @@ func (s *sshLexer) lexVoid() sshLexStateFn {
 			s.skip()
 			return s.lexComment(s.lexVoid)
 		case '\r':
-			fallthrough
+			if !s.follow("\r\n") {
+				// A lone carriage return is whitespace.
+				s.skip()
+				continue
+			}
+			s.emit(tokenEmptyLine)
+			s.skipLineEnding()
+			return s.lexVoid
 		case '\n':
 			s.emit(tokenEmptyLine)
-			s.skip()
-			continue
+			s.skipLineEnding()
+			return s.lexVoid
+		case eof:
+			s.next()
+			s.emit(tokenEOF)
+			return nil
 		}
 
 		if isSpace(next) {
 			s.skip()
+			continue
 		}
-
-		if isKeyStartChar(next) {
-			return s.lexKey
-		}
-
-		// removed IsKeyStartChar and lexKey. probably will need to readd
-
-		if next == eof {
-			s.next()
-			break
-		}
+		return s.lexKey
 	}
+}
 
-	s.emit(tokenEOF)
-	return nil
+// next consumes the next rune, which becomes part of the current token.
+func (s *sshLexer) next() rune {
+	r, size := s.decode()
+	if r == '\n' {
+		s.endbufferLine++
+		s.endbufferCol = 1
+	} else {
+		s.endbufferCol++
+	}
+	s.idx += size
+	return r
 }
 
+// ignore starts a new token at the next rune.
 func (s *sshLexer) ignore() {
-	s.buffer = make([]rune, 0)
+	s.start = s.idx
 	s.line = s.endbufferLine
 	s.col = s.endbufferCol
 }
@@ -180,61 +193,70 @@ func (s *sshLexer) skip() {
 	s.ignore()
 }
 
-func (s *sshLexer) emit(t tokenType) {
-	s.emitWithValue(t, string(s.buffer))
+// skipLineEnding skips a "\n" or "\r\n" line ending, or eof.
+func (s *sshLexer) skipLineEnding() {
+	if s.follow("\r\n") {
+		s.next()
+	}
+	s.skip()
 }
 
-func (s *sshLexer) emitWithValue(t tokenType, value string) {
-	tok := token{
+func (s *sshLexer) emit(t tokenType) {
+	s.tok = token{
 		Position: Position{s.line, s.col},
 		typ:      t,
-		val:      value,
+		val:      s.input[s.start:s.idx],
+		off:      s.start,
 	}
-	s.tokens <- tok
+	s.ready = true
 	s.ignore()
 }
 
-func (s *sshLexer) peek() rune {
-	if s.inputIdx >= len(s.input) {
-		return eof
+// decode returns the next rune and its size in bytes, or eof and 0.
+func (s *sshLexer) decode() (rune, int) {
+	if s.idx >= len(s.input) {
+		return eof, 0
 	}
+	if c := s.input[s.idx]; c < utf8.RuneSelf {
+		return rune(c), 1
+	}
+	return utf8.DecodeRuneInString(s.input[s.idx:])
+}
 
-	r := s.input[s.inputIdx]
+func (s *sshLexer) peek() rune {
+	r, _ := s.decode()
 	return r
 }
 
 func (s *sshLexer) follow(next string) bool {
-	inputIdx := s.inputIdx
-	for _, expectedRune := range next {
-		if inputIdx >= len(s.input) {
-			return false
-		}
-		r := s.input[inputIdx]
-		inputIdx++
-		if expectedRune != r {
-			return false
-		}
-	}
-	return true
+	return strings.HasPrefix(s.input[s.idx:], next)
 }
 
-func (s *sshLexer) run() {
-	for state := s.lexVoid; state != nil; {
-		state = state()
+// nextToken returns the next token. ok is false once the input is exhausted,
+// after the tokenEOF token has been returned.
+func (s *sshLexer) nextToken() (tok token, ok bool) {
+	for !s.ready && s.state != nil {
+		s.state = s.state()
 	}
-	close(s.tokens)
+	if !s.ready {
+		return token{}, false
+	}
+	s.ready = false
+	return s.tok, true
 }
 
-func lexSSH(input []byte) chan token {
-	runes := bytes.Runes(input)
+func lexSSH(input []byte) *sshLexer {
 	l := &sshLexer{
-		input:         runes,
-		tokens:        make(chan token),
+		input:         string(input),
 		line:          1,
 		col:           1,
 		endbufferLine: 1,
 		endbufferCol:  1,
 	}
-	go l.run()
-	return l.tokens
+	// A byte order mark is not part of the first line.
+	if strings.HasPrefix(l.input, byteOrderMark) {
+		l.start, l.idx = len(byteOrderMark), len(byteOrderMark)
+	}
+	l.state = l.lexVoid
+	return l
 }
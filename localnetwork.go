@@ -0,0 +1,119 @@
+package ssh_config
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+)
+
+// InterfaceLister lists the addresses of the local network interfaces, for
+// Match localnetwork.
+type InterfaceLister interface {
+	InterfaceAddrs() ([]net.Addr, error)
+}
+
+// systemInterfaces lists the interface addresses of this host.
+type systemInterfaces struct{}
+
+func (systemInterfaces) InterfaceAddrs() ([]net.Addr, error) {
+	return net.InterfaceAddrs()
+}
+
+// LocalNetworkMatcher returns a function for Context.LocalNetwork that
+// reports whether an address of the interfaces listed by l is in the address
+// list of a Match localnetwork criterion, like ssh. The list is
+// comma-separated CIDR networks or single addresses; an entry prefixed with
+// '!' excludes the addresses it contains. If l is nil, the interfaces of this
+// host are used. Resolve uses LocalNetworkMatcher(nil) when
+// Context.LocalNetwork is nil.
+func LocalNetworkMatcher(l InterfaceLister) func(cidrs string) (bool, error) {
+	if l == nil {
+		l = systemInterfaces{}
+	}
+	return func(cidrs string) (bool, error) {
+		entries, err := parseCIDRList(cidrs)
+		if err != nil {
+			return false, err
+		}
+		addrs, err := l.InterfaceAddrs()
+		if err != nil {
+			return false, fmt.Errorf("ssh_config: Match localnetwork: %v", err)
+		}
+		for _, a := range addrs {
+			addr, ok := interfaceAddr(a)
+			if ok && matchCIDRList(addr, entries) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+}
+
+type cidrEntry struct {
+	prefix  netip.Prefix
+	negated bool
+}
+
+// parseCIDRList parses a comma-separated list of networks, like ssh's
+// addr_match_cidr_list. Networks must not have host bits set.
+func parseCIDRList(list string) ([]cidrEntry, error) {
+	var entries []cidrEntry
+	for _, field := range strings.Split(list, ",") {
+		field = strings.TrimSpace(field)
+		entry := cidrEntry{}
+		if strings.HasPrefix(field, "!") {
+			entry.negated = true
+			field = field[1:]
+		}
+		if field == "" {
+			return nil, fmt.Errorf("ssh_config: empty network in %q", list)
+		}
+		var err error
+		if strings.Contains(field, "/") {
+			entry.prefix, err = netip.ParsePrefix(field)
+		} else {
+			var addr netip.Addr
+			addr, err = netip.ParseAddr(field)
+			entry.prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		if err != nil {
+			return nil, fmt.Errorf("ssh_config: invalid network %q", field)
+		}
+		if entry.prefix.Masked() != entry.prefix {
+			return nil, fmt.Errorf("ssh_config: inconsistent mask length for network %q", field)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// matchCIDRList reports whether addr is in a network of entries and in none
+// of the negated ones.
+func matchCIDRList(addr netip.Addr, entries []cidrEntry) bool {
+	matched := false
+	for _, e := range entries {
+		if !e.prefix.Contains(addr) {
+			continue
+		}
+		if e.negated {
+			return false
+		}
+		matched = true
+	}
+	return matched
+}
+
+func interfaceAddr(a net.Addr) (netip.Addr, bool) {
+	var ip net.IP
+	switch v := a.(type) {
+	case *net.IPNet:
+		ip = v.IP
+	case *net.IPAddr:
+		ip = v.IP
+	default:
+		return netip.Addr{}, false
+	}
+	addr, ok := netip.AddrFromSlice(ip)
+	return addr.Unmap(), ok
+}
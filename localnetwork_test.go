@@ -0,0 +1,81 @@
+package ssh_config
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+type fakeInterfaces []string
+
+func (f fakeInterfaces) InterfaceAddrs() ([]net.Addr, error) {
+	var addrs []net.Addr
+	for _, s := range f {
+		_, ipnet, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, err
+		}
+		ipnet.IP = net.ParseIP(strings.Split(s, "/")[0])
+		addrs = append(addrs, ipnet)
+	}
+	return addrs, nil
+}
+
+func TestLocalNetworkMatcher(t *testing.T) {
+	match := LocalNetworkMatcher(fakeInterfaces{"127.0.0.1/8", "192.168.1.20/24", "2001:db8::5/64"})
+	tests := []struct {
+		cidrs string
+		want  bool
+	}{
+		{"192.168.1.0/24", true},
+		{"10.0.0.0/8", false},
+		{"10.0.0.0/8,192.168.0.0/16", true},
+		{"10.0.0.0/8, 2001:db8::/32", true},
+		{"192.168.1.20", true},
+		{"192.168.0.0/16,!192.168.1.0/24", false},
+		{"!10.0.0.0/8", false},
+		{"0.0.0.0/0,!192.168.1.0/24", true},
+	}
+	for _, tt := range tests {
+		got, err := match(tt.cidrs)
+		if err != nil {
+			t.Errorf("match(%q): %v", tt.cidrs, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("match(%q) got %v, want %v", tt.cidrs, got, tt.want)
+		}
+	}
+	for _, bad := range []string{"", "10.0.0.0/8,", "192.168.1.1/24", "10.0.0.0/33", "example.com"} {
+		if _, err := match(bad); err == nil {
+			t.Errorf("match(%q): expected error", bad)
+		}
+	}
+}
+
+func TestResolveMatchLocalNetwork(t *testing.T) {
+	input := "Match localnetwork 10.1.0.0/16,!10.1.99.0/24\n  User office\nMatch all\n  User remote\n"
+	cfg, err := Decode(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	for _, tt := range []struct {
+		addr string
+		want string
+	}{
+		{"10.1.2.3/16", "office"},
+		{"10.1.99.3/24", "remote"},
+	} {
+		ctx := Context{HostArg: "web", LocalNetwork: LocalNetworkMatcher(fakeInterfaces{tt.addr})}
+		res, err := cfg.Resolve(ctx, Strict())
+		if err != nil {
+			t.Fatalf("Resolve: %v", err)
+		}
+		if got := res.Get("User"); got != tt.want {
+			t.Errorf("address %s: User got %q, want %q", tt.addr, got, tt.want)
+		}
+	}
+	if _, err := cfg.Resolve(Context{HostArg: "web"}, Strict()); err != nil {
+		t.Errorf("Resolve with the default matcher: %v", err)
+	}
+}
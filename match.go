@@ -0,0 +1,151 @@
+package ssh_config
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// MatchCriterion is a single criterion of a Match line, such as "user alice"
+// or "!exec \"test -f /tmp/vpn\"".
+type MatchCriterion struct {
+	// Name is the criterion keyword in lower case, such as "host", "exec"
+	// or "all".
+	Name string
+	// Arg is the argument of the criterion, without quotes. It is empty for
+	// all, canonical and final.
+	Arg string
+	// Negated is set if the criterion is prefixed with '!'.
+	Negated bool
+}
+
+// matchFlags are the criteria that take no argument.
+var matchFlags = map[string]bool{
+	"all":       true,
+	"canonical": true,
+	"final":     true,
+}
+
+// matchAttributes are the criteria that take an argument.
+var matchAttributes = map[string]bool{
+	"command":      true,
+	"exec":         true,
+	"host":         true,
+	"localnetwork": true,
+	"localuser":    true,
+	"originalhost": true,
+	"sessiontype":  true,
+	"tagged":       true,
+	"user":         true,
+	"version":      true,
+}
+
+// String returns c as it would appear on a Match line. Arguments containing
+// whitespace, quotes or backslashes are quoted.
+func (c MatchCriterion) String() string {
+	name := c.Name
+	if c.Negated {
+		name = "!" + name
+	}
+	if matchFlags[strings.ToLower(c.Name)] && c.Arg == "" {
+		return name
+	}
+	return name + " " + quoteArg(c.Arg)
+}
+
+// ParseMatchCriteria parses the criteria of a Match line, such as
+// `host *.example.com !exec "test -f /tmp/vpn"`. Arguments may be quoted or
+// given as name=arg. It fails on unknown criteria, missing arguments and
+// invalid localnetwork lists, and if all is combined with other criteria.
+func ParseMatchCriteria(s string) ([]MatchCriterion, error) {
+	fields, err := argvSplit(s)
+	if err != nil {
+		return nil, fmt.Errorf("ssh_config: unterminated quoted Match criterion")
+	}
+	criteria := make([]MatchCriterion, 0, len(fields))
+	for i := 0; i < len(fields); i++ {
+		field := fields[i]
+		negated := strings.HasPrefix(field, "!")
+		if negated {
+			field = strings.TrimPrefix(field, "!")
+		}
+		name := strings.ToLower(field)
+		if matchFlags[name] {
+			criteria = append(criteria, MatchCriterion{Name: name, Negated: negated})
+			continue
+		}
+		arg := ""
+		if strings.Contains(field, "=") {
+			parts := strings.SplitN(field, "=", 2)
+			name = strings.ToLower(parts[0])
+			arg = parts[1]
+		} else {
+			if i+1 >= len(fields) {
+				return nil, fmt.Errorf("ssh_config: missing argument for Match %q", name)
+			}
+			arg = fields[i+1]
+			i++
+		}
+		criteria = append(criteria, MatchCriterion{Name: name, Arg: arg, Negated: negated})
+	}
+	if err := validateMatchCriteria(criteria); err != nil {
+		return nil, err
+	}
+	return criteria, nil
+}
+
+// validateMatchCriteria checks criteria as ssh does when it reads a Match
+// line.
+func validateMatchCriteria(criteria []MatchCriterion) error {
+	if len(criteria) == 0 {
+		return fmt.Errorf("ssh_config: Match requires criteria")
+	}
+	for i, c := range criteria {
+		name := strings.ToLower(c.Name)
+		switch {
+		case name == "all":
+			if len(criteria) == 1 {
+				continue
+			}
+			if len(criteria) == 2 && i == 1 {
+				first := strings.ToLower(criteria[0].Name)
+				if first == "canonical" || first == "final" {
+					continue
+				}
+			}
+			return fmt.Errorf("ssh_config: Match all cannot be combined with other attributes")
+		case matchFlags[name]:
+		case name == "localnetwork":
+			if _, err := parseCIDRList(c.Arg); err != nil {
+				return err
+			}
+		case !matchAttributes[name]:
+			return fmt.Errorf("ssh_config: unsupported Match attribute %q", c.Name)
+		}
+	}
+	return nil
+}
+
+// formatMatchCriteria returns criteria as they would appear on a Match line.
+func formatMatchCriteria(criteria []MatchCriterion) string {
+	parts := make([]string, len(criteria))
+	for i, c := range criteria {
+		parts[i] = c.String()
+	}
+	return strings.Join(parts, " ")
+}
+
+// criteriaString returns the criteria of m as written in the config file if
+// they have not been modified, and reformatted otherwise.
+func (m *Match) criteriaString() string {
+	if m.rawCriteria != "" && slices.Equal(m.Criteria, m.parsedCriteria) {
+		return m.rawCriteria
+	}
+	return formatMatchCriteria(m.Criteria)
+}
+
+// invalid reports whether tolerant decoding could not parse the criteria of m
+// and they have not been replaced since.
+func (m *Match) invalid() bool {
+	return m.err != nil && slices.Equal(m.Criteria, m.parsedCriteria)
+}
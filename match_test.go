@@ -2,6 +2,7 @@ package ssh_config
 
 import (
 	"bytes"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -21,8 +22,7 @@ func TestMatchParseBlocks(t *testing.T) {
 	if _, ok := cfg.Blocks[1].(*Match); !ok {
 		t.Fatalf("expected second block to be Match, got %T", cfg.Blocks[1])
 	}
-	expected := string(bytes.ReplaceAll(data, []byte("\t"), []byte(" ")))
-	if got := cfg.String(); got != expected {
+	if got, expected := cfg.String(), string(data); got != expected {
 		t.Errorf("string mismatch:\n%q\nwant:\n%q", got, expected)
 	}
 }
@@ -33,8 +33,72 @@ func TestMatchStringPreservesWhitespace(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Decode: %v", err)
 	}
-	expected := strings.ReplaceAll(input, "\t", " ")
-	if got := cfg.String(); got != expected {
-		t.Errorf("string mismatch:\n%q\nwant:\n%q", got, expected)
+	if got := cfg.String(); got != input {
+		t.Errorf("string mismatch:\n%q\nwant:\n%q", got, input)
+	}
+}
+
+func TestMatchCriteriaParsed(t *testing.T) {
+	input := "Match host=*.example.com !user root exec \"test -f /tmp/vpn\" # vpn\n  Port 2222\n"
+	cfg, err := Decode(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	m := cfg.Blocks[1].(*Match)
+	want := []MatchCriterion{
+		{Name: "host", Arg: "*.example.com"},
+		{Name: "user", Arg: "root", Negated: true},
+		{Name: "exec", Arg: "test -f /tmp/vpn"},
+	}
+	if !reflect.DeepEqual(m.Criteria, want) {
+		t.Fatalf("Criteria got %+v, want %+v", m.Criteria, want)
+	}
+	if got := cfg.String(); got != input {
+		t.Errorf("unchanged criteria should keep their text, got %q", got)
+	}
+
+	m.Criteria[1].Arg = "admin"
+	m.Criteria = append(m.Criteria, MatchCriterion{Name: "localuser", Arg: `o"dd`})
+	wantLine := `Match host *.example.com !user admin exec "test -f /tmp/vpn" localuser "o\"dd" # vpn`
+	if got := strings.SplitN(cfg.String(), "\n", 2)[0]; got != wantLine {
+		t.Errorf("edited Match line got %q, want %q", got, wantLine)
+	}
+	reparsed, err := ParseMatchCriteria(formatMatchCriteria(m.Criteria))
+	if err != nil {
+		t.Fatalf("ParseMatchCriteria: %v", err)
+	}
+	if !reflect.DeepEqual(reparsed, m.Criteria) {
+		t.Errorf("round trip got %+v, want %+v", reparsed, m.Criteria)
+	}
+
+	res, err := cfg.Resolve(Context{HostArg: "web.example.com", LocalUser: `o"dd`, Exec: func(string) (bool, error) { return true, nil }})
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if got := res.Get("Port"); got != "2222" {
+		t.Errorf("Port got %q, want 2222 from the edited Match", got)
+	}
+}
+
+func TestMatchCriteriaParseErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"Match\n", "missing value for Match"},
+		{"Match host\n", `missing argument for Match "host"`},
+		{"Match bogus x\n", `unsupported Match attribute "bogus"`},
+		{"Match all host x\n", "Match all cannot be combined"},
+		{"Match exec \"unterminated\n", "unterminated quoted Match criterion"},
+		{"Match localnetwork 10.0.0.1/8\n", "inconsistent mask length"},
+	}
+	for _, tt := range tests {
+		_, err := Decode(strings.NewReader(tt.input))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Decode(%q) got error %v, want %q", tt.input, err, tt.want)
+		}
+	}
+	if _, err := ParseMatchCriteria("canonical all"); err != nil {
+		t.Errorf("canonical all: %v", err)
 	}
 }
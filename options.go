@@ -0,0 +1,220 @@
+package ssh_config
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ClientOptions holds the parsed values of commonly used client options. Each
+// field is filled from the directive named in its ssh tag, which is looked up
+// in the embedded OpenSSH spec; fields whose directive has no value are left
+// at their zero value. Values that accept percent tokens or environment
+// variables are expanded, as with GetExpanded.
+type ClientOptions struct {
+	HostName      string `ssh:"HostName"`
+	User          string `ssh:"User"`
+	Port          int    `ssh:"Port"`
+	AddressFamily string `ssh:"AddressFamily"`
+	BindAddress   string `ssh:"BindAddress"`
+
+	IdentityFiles    []string `ssh:"IdentityFile"`
+	IdentitiesOnly   bool     `ssh:"IdentitiesOnly"`
+	IdentityAgent    string   `ssh:"IdentityAgent"`
+	CertificateFiles []string `ssh:"CertificateFile"`
+
+	ProxyJump    []JumpHost `ssh:"ProxyJump"`
+	ProxyCommand string     `ssh:"ProxyCommand"`
+
+	LocalForwards        []Forward `ssh:"LocalForward"`
+	RemoteForwards       []Forward `ssh:"RemoteForward"`
+	DynamicForwards      []Forward `ssh:"DynamicForward"`
+	ExitOnForwardFailure bool      `ssh:"ExitOnForwardFailure"`
+
+	ConnectTimeout      time.Duration `ssh:"ConnectTimeout"`
+	ConnectionAttempts  int           `ssh:"ConnectionAttempts"`
+	ServerAliveInterval time.Duration `ssh:"ServerAliveInterval"`
+	ServerAliveCountMax int           `ssh:"ServerAliveCountMax"`
+	TCPKeepAlive        bool          `ssh:"TCPKeepAlive"`
+
+	Ciphers                  []string `ssh:"Ciphers"`
+	MACs                     []string `ssh:"MACs"`
+	KexAlgorithms            []string `ssh:"KexAlgorithms"`
+	HostKeyAlgorithms        []string `ssh:"HostKeyAlgorithms"`
+	PubkeyAcceptedAlgorithms []string `ssh:"PubkeyAcceptedAlgorithms"`
+
+	BatchMode                    bool     `ssh:"BatchMode"`
+	Compression                  bool     `ssh:"Compression"`
+	PasswordAuthentication       bool     `ssh:"PasswordAuthentication"`
+	KbdInteractiveAuthentication bool     `ssh:"KbdInteractiveAuthentication"`
+	PubkeyAuthentication         string   `ssh:"PubkeyAuthentication"`
+	PreferredAuthentications     []string `ssh:"PreferredAuthentications"`
+
+	StrictHostKeyChecking string   `ssh:"StrictHostKeyChecking"`
+	UserKnownHostsFiles   []string `ssh:"UserKnownHostsFile"`
+	GlobalKnownHostsFiles []string `ssh:"GlobalKnownHostsFile"`
+	HashKnownHosts        bool     `ssh:"HashKnownHosts"`
+
+	ControlMaster  string `ssh:"ControlMaster"`
+	ControlPath    string `ssh:"ControlPath"`
+	ControlPersist string `ssh:"ControlPersist"`
+
+	ForwardAgent  string   `ssh:"ForwardAgent"`
+	RequestTTY    string   `ssh:"RequestTTY"`
+	RemoteCommand string   `ssh:"RemoteCommand"`
+	SendEnv       []string `ssh:"SendEnv"`
+	LogLevel      string   `ssh:"LogLevel"`
+}
+
+// Options returns the commonly used client options of r, parsed. It fails if
+// a value does not fit its field, naming the directive in the error.
+func (r *Result) Options() (*ClientOptions, error) {
+	var opts ClientOptions
+	if err := r.Unmarshal(&opts); err != nil {
+		return nil, err
+	}
+	for _, fwd := range opts.LocalForwards {
+		if fwd.Connect == (ForwardAddr{}) {
+			return nil, fmt.Errorf("ssh_config: LocalForward: missing destination")
+		}
+	}
+	for _, fwd := range opts.DynamicForwards {
+		if fwd.Connect != (ForwardAddr{}) {
+			return nil, fmt.Errorf("ssh_config: DynamicForward: unexpected destination")
+		}
+	}
+	return &opts, nil
+}
+
+// JumpHost is a hop of ProxyJump, written as [user@]host[:port] or
+// ssh://[user@]host[:port].
+type JumpHost struct {
+	User string
+	Host string
+	// Port is 0 if the hop does not specify one.
+	Port int
+}
+
+// UnmarshalText parses a single ProxyJump hop.
+func (j *JumpHost) UnmarshalText(text []byte) error {
+	s := strings.TrimPrefix(string(text), "ssh://")
+	var hop JumpHost
+	if idx := strings.LastIndexByte(s, '@'); idx >= 0 {
+		hop.User, s = s[:idx], s[idx+1:]
+	}
+	host, port, err := splitHostPort(s, false)
+	if err != nil || host == "" {
+		return fmt.Errorf("invalid jump host %q", text)
+	}
+	hop.Host, hop.Port = host, port
+	*j = hop
+	return nil
+}
+
+// String returns j in the [user@]host[:port] form.
+func (j JumpHost) String() string {
+	s := j.Host
+	if j.Port != 0 {
+		s = net.JoinHostPort(j.Host, strconv.Itoa(j.Port))
+	}
+	if j.User != "" {
+		s = j.User + "@" + s
+	}
+	return s
+}
+
+// Forward is a LocalForward, RemoteForward or DynamicForward specification.
+type Forward struct {
+	// Listen is the address ssh (or, for RemoteForward, the server) listens
+	// on.
+	Listen ForwardAddr
+	// Connect is the forwarding destination. It is zero for DynamicForward,
+	// and for a RemoteForward that acts as a SOCKS proxy.
+	Connect ForwardAddr
+}
+
+// ForwardAddr is an endpoint of a Forward: either a host and port or a Unix
+// domain socket path.
+type ForwardAddr struct {
+	// Host is the bind address or destination host. It is empty if a listen
+	// address only gives a port.
+	Host string
+	Port int
+	Path string
+}
+
+// UnmarshalText parses a forwarding specification: a listen address
+// ([bind_address:]port or a socket path), optionally followed by a
+// destination (host:hostport or a socket path).
+func (f *Forward) UnmarshalText(text []byte) error {
+	fields := splitArgs(string(text))
+	if len(fields) == 0 || len(fields) > 2 {
+		return fmt.Errorf("invalid forward %q", text)
+	}
+	var fwd Forward
+	var err error
+	if fwd.Listen, err = parseForwardAddr(fields[0], false); err != nil {
+		return fmt.Errorf("invalid forward %q: %v", text, err)
+	}
+	if len(fields) == 2 {
+		if fwd.Connect, err = parseForwardAddr(fields[1], true); err != nil {
+			return fmt.Errorf("invalid forward %q: %v", text, err)
+		}
+	}
+	*f = fwd
+	return nil
+}
+
+func parseForwardAddr(s string, needHost bool) (ForwardAddr, error) {
+	if strings.Contains(s, "/") {
+		return ForwardAddr{Path: s}, nil
+	}
+	host, port, err := splitHostPort(s, true)
+	if err != nil {
+		return ForwardAddr{}, err
+	}
+	if needHost && host == "" {
+		return ForwardAddr{}, fmt.Errorf("missing host in %q", s)
+	}
+	return ForwardAddr{Host: host, Port: port}, nil
+}
+
+// splitHostPort splits [host:]port, host[:port] or [ipv6][:port]. If
+// needPort is set the port is required and s may be a bare port.
+func splitHostPort(s string, needPort bool) (string, int, error) {
+	var host, port string
+	switch {
+	case strings.HasPrefix(s, "["):
+		end := strings.IndexByte(s, ']')
+		if end < 0 {
+			return "", 0, fmt.Errorf("missing ']' in %q", s)
+		}
+		host, port = s[1:end], s[end+1:]
+		if port != "" {
+			if port[0] != ':' {
+				return "", 0, fmt.Errorf("invalid address %q", s)
+			}
+			port = port[1:]
+		}
+	case strings.IndexByte(s, ':') >= 0:
+		idx := strings.LastIndexByte(s, ':')
+		host, port = s[:idx], s[idx+1:]
+	case needPort:
+		port = s
+	default:
+		host = s
+	}
+	if port == "" {
+		if needPort {
+			return "", 0, fmt.Errorf("missing port in %q", s)
+		}
+		return host, 0, nil
+	}
+	n, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid port %q", port)
+	}
+	return host, int(n), nil
+}
@@ -0,0 +1,139 @@
+package ssh_config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResultOptions(t *testing.T) {
+	input := `Host web
+  HostName web.internal
+  User deploy
+  Port 2222
+  IdentityFile ~/.ssh/id_%r
+  IdentitiesOnly yes
+  ProxyJump alice@bastion:2200,ssh://[2001:db8::1]
+  LocalForward 8080 localhost:80
+  LocalForward 127.0.0.1:5432 /run/postgres.sock
+  RemoteForward 9000
+  DynamicForward [::1]:1080
+  ConnectTimeout 1m
+  ServerAliveInterval 30
+  ServerAliveCountMax 5
+  Ciphers aes128-ctr,aes256-ctr
+  BatchMode yes
+  StrictHostKeyChecking Accept-New
+  UserKnownHostsFile ~/.ssh/known_hosts /etc/known_hosts
+  ControlPath ~/.ssh/cm-%C
+`
+	res := resolveString(t, input, Context{HostArg: "web", LocalUser: "local", HomeDir: "/home/fixture"})
+	opts, err := res.Options()
+	if err != nil {
+		t.Fatalf("Options: %v", err)
+	}
+	if opts.HostName != "web.internal" || opts.User != "deploy" || opts.Port != 2222 {
+		t.Errorf("got HostName %q, User %q, Port %d", opts.HostName, opts.User, opts.Port)
+	}
+	if want := []string{"/home/fixture/.ssh/id_deploy"}; !reflect.DeepEqual(opts.IdentityFiles, want) {
+		t.Errorf("IdentityFiles got %q, want %q", opts.IdentityFiles, want)
+	}
+	if !opts.IdentitiesOnly || !opts.BatchMode || opts.PasswordAuthentication {
+		t.Errorf("got IdentitiesOnly %v, BatchMode %v, PasswordAuthentication %v", opts.IdentitiesOnly, opts.BatchMode, opts.PasswordAuthentication)
+	}
+	wantJumps := []JumpHost{{User: "alice", Host: "bastion", Port: 2200}, {Host: "2001:db8::1"}}
+	if !reflect.DeepEqual(opts.ProxyJump, wantJumps) {
+		t.Errorf("ProxyJump got %+v, want %+v", opts.ProxyJump, wantJumps)
+	}
+	wantLocal := []Forward{
+		{Listen: ForwardAddr{Port: 8080}, Connect: ForwardAddr{Host: "localhost", Port: 80}},
+		{Listen: ForwardAddr{Host: "127.0.0.1", Port: 5432}, Connect: ForwardAddr{Path: "/run/postgres.sock"}},
+	}
+	if !reflect.DeepEqual(opts.LocalForwards, wantLocal) {
+		t.Errorf("LocalForwards got %+v, want %+v", opts.LocalForwards, wantLocal)
+	}
+	if want := []Forward{{Listen: ForwardAddr{Port: 9000}}}; !reflect.DeepEqual(opts.RemoteForwards, want) {
+		t.Errorf("RemoteForwards got %+v", opts.RemoteForwards)
+	}
+	if want := []Forward{{Listen: ForwardAddr{Host: "::1", Port: 1080}}}; !reflect.DeepEqual(opts.DynamicForwards, want) {
+		t.Errorf("DynamicForwards got %+v", opts.DynamicForwards)
+	}
+	if opts.ConnectTimeout != time.Minute || opts.ServerAliveInterval != 30*time.Second || opts.ServerAliveCountMax != 5 {
+		t.Errorf("got ConnectTimeout %v, ServerAliveInterval %v, ServerAliveCountMax %d", opts.ConnectTimeout, opts.ServerAliveInterval, opts.ServerAliveCountMax)
+	}
+	if want := []string{"aes128-ctr", "aes256-ctr"}; !reflect.DeepEqual(opts.Ciphers, want) {
+		t.Errorf("Ciphers got %q", opts.Ciphers)
+	}
+	if opts.StrictHostKeyChecking != "accept-new" {
+		t.Errorf("StrictHostKeyChecking got %q", opts.StrictHostKeyChecking)
+	}
+	if want := []string{"/home/fixture/.ssh/known_hosts", "/etc/known_hosts"}; !reflect.DeepEqual(opts.UserKnownHostsFiles, want) {
+		t.Errorf("UserKnownHostsFiles got %q", opts.UserKnownHostsFiles)
+	}
+	if !strings.HasPrefix(opts.ControlPath, "/home/fixture/.ssh/cm-") || strings.Contains(opts.ControlPath, "%") {
+		t.Errorf("ControlPath got %q", opts.ControlPath)
+	}
+	if len(opts.KexAlgorithms) == 0 {
+		t.Error("expected the default KexAlgorithms")
+	}
+}
+
+func TestResultOptionsErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"Host *\n  Port http\n", `Port: "http" is not an unsigned integer`},
+		{"Host *\n  ProxyJump user@\n", `ProxyJump: invalid jump host "user@"`},
+		{"Host *\n  LocalForward 8080\n", "LocalForward: missing destination"},
+		{"Host *\n  LocalForward 8080 host:99999\n", `LocalForward: invalid forward "8080 host:99999"`},
+		{"Host *\n  ConnectTimeout soon\n", `ConnectTimeout: invalid time "soon"`},
+	}
+	for _, tt := range tests {
+		res := resolveString(t, tt.input, Context{HostArg: "web", LocalUser: "local"})
+		_, err := res.Options()
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Options(%q) got error %v, want %q", tt.input, err, tt.want)
+		}
+	}
+}
+
+func TestClientOptionsTagsInSpec(t *testing.T) {
+	spec, err := loadClientSpec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rt := reflect.TypeOf(ClientOptions{})
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		key := field.Tag.Get("ssh")
+		d := spec.lookupDirective(key)
+		if d == nil || d.Status != "supported" {
+			t.Errorf("field %s: %q is not a supported directive", field.Name, key)
+			continue
+		}
+		if field.Type.Kind() == reflect.Bool && d.Type != "yesno" && d.Type != "enum" {
+			t.Errorf("field %s: %s is a %s directive", field.Name, key, d.Type)
+		}
+	}
+}
+
+func TestForwardParse(t *testing.T) {
+	var fwd Forward
+	if err := fwd.UnmarshalText([]byte("[::1]:8080 [2001:db8::2]:22")); err != nil {
+		t.Fatal(err)
+	}
+	want := Forward{Listen: ForwardAddr{Host: "::1", Port: 8080}, Connect: ForwardAddr{Host: "2001:db8::2", Port: 22}}
+	if fwd != want {
+		t.Errorf("got %+v, want %+v", fwd, want)
+	}
+	for _, bad := range []string{"", "a b c", "8080 :22", "70000 host:22", "[::1 host:22"} {
+		if err := fwd.UnmarshalText([]byte(bad)); err == nil {
+			t.Errorf("UnmarshalText(%q): expected error", bad)
+		}
+	}
+	if got := (JumpHost{User: "u", Host: "::1", Port: 22}).String(); got != "u@[::1]:22" {
+		t.Errorf("JumpHost String got %q", got)
+	}
+}
@@ -0,0 +1,104 @@
+package ssh_config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Origin describes where a resolved value came from.
+type Origin struct {
+	// Filename is the file containing the directive. It is empty for configs
+	// read with Decode or DecodeBytes, and for defaults.
+	Filename string
+	// Position is the location of the directive within Filename.
+	Position Position
+	// Block is the Host or Match block enclosing the directive. It is nil for
+	// defaults.
+	Block Block
+	// Includes lists the Include directives that were followed to reach
+	// Filename, outermost first.
+	Includes []IncludeStep
+	// Default is true if the value was not set by any config file, but came
+	// from the OpenSSH client spec or from the Context passed to Resolve.
+	Default bool
+}
+
+// IncludeStep records a single Include directive followed during Resolve.
+type IncludeStep struct {
+	// Filename is the file containing the Include directive.
+	Filename string
+	// Position is the location of the Include directive within Filename.
+	Position Position
+	// Path is the file that was included.
+	Path string
+}
+
+// String returns a short description of o, such as
+// "/home/user/.ssh/config:12:3 (Host *.example.com)".
+func (o Origin) String() string {
+	if o.Default {
+		return "default"
+	}
+	var buf strings.Builder
+	if o.Filename != "" {
+		buf.WriteString(o.Filename)
+	} else {
+		buf.WriteString("<config>")
+	}
+	fmt.Fprintf(&buf, ":%d:%d", o.Position.Line, o.Position.Col)
+	if header := blockHeader(o.Block); header != "" {
+		fmt.Fprintf(&buf, " (%s)", header)
+	}
+	for i := len(o.Includes) - 1; i >= 0; i-- {
+		step := o.Includes[i]
+		name := step.Filename
+		if name == "" {
+			name = "<config>"
+		}
+		fmt.Fprintf(&buf, ", included from %s:%d:%d", name, step.Position.Line, step.Position.Col)
+	}
+	return buf.String()
+}
+
+// blockHeader returns the Host or Match line of b, without comments.
+func blockHeader(b Block) string {
+	switch b := b.(type) {
+	case *Host:
+		if b.implicit {
+			return ""
+		}
+		patterns := make([]string, len(b.Patterns))
+		for i, pat := range b.Patterns {
+			patterns[i] = pat.String()
+		}
+		return "Host " + strings.Join(patterns, " ")
+	case *Match:
+		return "Match " + b.criteriaString()
+	}
+	return ""
+}
+
+// Origin returns the origin of the effective value for key, as returned by
+// Get. The boolean is false if key has no value.
+func (r *Result) Origin(key string) (Origin, bool) {
+	origins := r.Origins(key)
+	if len(origins) == 0 {
+		return Origin{}, false
+	}
+	return origins[0], true
+}
+
+// Origins returns the origins of all effective values for key, in the same
+// order as GetAll.
+func (r *Result) Origins(key string) []Origin {
+	if r == nil {
+		return nil
+	}
+	origins := r.origins[strings.ToLower(key)]
+	if len(origins) == 0 {
+		return nil
+	}
+	out := make([]Origin, len(origins))
+	copy(out, origins)
+	return out
+}
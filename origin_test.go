@@ -0,0 +1,95 @@
+package ssh_config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolveOrigin(t *testing.T) {
+	input := "Host *.example.com\n  User first\nHost db.example.com\n  User second\n  IdentityFile one\nMatch all\n  IdentityFile two\n"
+	cfg, err := Decode(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	res, err := cfg.Resolve(Context{HostArg: "db.example.com", LocalUser: "local"})
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+
+	origin, ok := res.Origin("user")
+	if !ok {
+		t.Fatal("expected origin for User")
+	}
+	if origin.Position != (Position{2, 3}) {
+		t.Errorf("User position got %v, want (2, 3)", origin.Position)
+	}
+	host, ok := origin.Block.(*Host)
+	if !ok || host.Patterns[0].String() != "*.example.com" {
+		t.Errorf("User block got %v, want Host *.example.com", origin.Block)
+	}
+	if origin.Default {
+		t.Error("User origin should not be a default")
+	}
+
+	origins := res.Origins("IdentityFile")
+	if len(origins) != 2 {
+		t.Fatalf("IdentityFile origins got %d, want 2", len(origins))
+	}
+	if origins[0].Position.Line != 5 || origins[1].Position.Line != 7 {
+		t.Errorf("IdentityFile lines got %d and %d, want 5 and 7", origins[0].Position.Line, origins[1].Position.Line)
+	}
+	if _, ok := origins[1].Block.(*Match); !ok {
+		t.Errorf("second IdentityFile block got %T, want *Match", origins[1].Block)
+	}
+	if got := origins[1].String(); got != "<config>:7:3 (Match all)" {
+		t.Errorf("origin String got %q", got)
+	}
+
+	origin, ok = res.Origin("Port")
+	if !ok || !origin.Default {
+		t.Errorf("Port origin got %+v, want default", origin)
+	}
+	origin, ok = res.Origin("HostName")
+	if !ok || !origin.Default {
+		t.Errorf("HostName origin got %+v, want default", origin)
+	}
+	if _, ok := res.Origin("ProxyJump"); ok {
+		t.Error("expected no origin for unset ProxyJump")
+	}
+}
+
+func TestResolveOriginInclude(t *testing.T) {
+	dir := t.TempDir()
+	included := filepath.Join(dir, "included")
+	if err := os.WriteFile(included, []byte("Host inc.example.com\n  ProxyJump bastion\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	main := filepath.Join(dir, "config")
+	if err := os.WriteFile(main, []byte("Host *\n  Include "+included+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	us := &UserSettings{
+		userConfigFinder:   testConfigFinder(main),
+		systemConfigFinder: nullConfigFinder,
+	}
+	res := resolveUserSettings(t, us, "inc.example.com")
+	origin, ok := res.Origin("ProxyJump")
+	if !ok {
+		t.Fatal("expected origin for ProxyJump")
+	}
+	if origin.Filename != included {
+		t.Errorf("Filename got %q, want %q", origin.Filename, included)
+	}
+	if origin.Position != (Position{2, 3}) {
+		t.Errorf("Position got %v, want (2, 3)", origin.Position)
+	}
+	if len(origin.Includes) != 1 {
+		t.Fatalf("Includes got %v, want one step", origin.Includes)
+	}
+	step := origin.Includes[0]
+	if step.Filename != main || step.Path != included || step.Position != (Position{2, 3}) {
+		t.Errorf("Include step got %+v", step)
+	}
+}
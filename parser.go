@@ -2,65 +2,148 @@ package ssh_config
 
 import (
 	"fmt"
+	"slices"
 	"strings"
 	"unicode"
 )
 
 type sshParser struct {
-	flow          chan token
+	lexer         *sshLexer
 	config        *Config
-	tokensBuffer  []token
+	lookahead     token
+	peeked        bool // lookahead holds the next token
 	currentTable  []string
 	seenTableKeys []string
 	currentNodes  *[]Node
-	// /etc/ssh parser or local parser - used to find the default for relative
-	// filepaths in the Include directive
-	system bool
-	depth  uint8
+	// /etc/ssh parser or local parser, include depth and home directory -
+	// used to find the default for relative filepaths in the Include directive
+	opts parseOptions
+	// lines is the config text, split into lines on first use by badLine.
+	lines []string
+	// err is the first error, which stops parsing unless opts.tolerant is
+	// set; errs are the errors recorded in tolerant mode.
+	err  *ParseError
+	errs ParseErrors
 }
 
 type sshParserStateFn func() sshParserStateFn
 
-// Formats and panics an error message based on a token
-func (p *sshParser) raiseErrorf(tok *token, msg string) {
-	// TODO this format is ugly
-	panic(tok.Position.String() + ": " + msg)
+// raise reports an error of the given kind at the position of tok.
+func (p *sshParser) raise(tok *token, kind ErrorKind, err error) *ParseError {
+	perr := &ParseError{Position: tok.Position, Kind: kind, Err: err}
+	p.record(perr)
+	return perr
 }
 
-func (p *sshParser) raiseError(tok *token, err error) {
-	if err == ErrDepthExceeded {
-		panic(err)
+// record records perr. Unless the parser is tolerant, the first error stops
+// parsing once the current state function returns.
+func (p *sshParser) record(perr *ParseError) {
+	if !p.opts.tolerant {
+		if p.err == nil {
+			p.err = perr
+		}
+		return
+	}
+	p.errs = append(p.errs, perr)
+}
+
+// fail reports an error at tok and, in tolerant mode, keeps the line of key
+// as a BadLine.
+func (p *sshParser) fail(key, tok *token, kind ErrorKind, err error) sshParserStateFn {
+	perr := p.raise(tok, kind, err)
+	*p.currentNodes = append(*p.currentNodes, p.badLine(key, perr))
+	return p.parseStart
+}
+
+func (p *sshParser) badLine(key *token, perr *ParseError) *BadLine {
+	in := p.lexer.input
+	start := p.lineStart(key.off)
+	end, eol := len(in), ""
+	if idx := strings.IndexByte(in[key.off:], '\n'); idx >= 0 {
+		end, eol = key.off+idx, "\n"
+		if strings.HasSuffix(in[:end], "\r") {
+			end, eol = end-1, "\r\n"
+		}
+	}
+	return &BadLine{
+		Text:       in[start:end],
+		Err:        perr,
+		lineFormat: lineFormat{eol: eol},
+		position:   key.Position,
+	}
+}
+
+// lineStart returns the offset of the line containing off, after any byte
+// order mark.
+func (p *sshParser) lineStart(off int) int {
+	in := p.lexer.input
+	start := strings.LastIndexByte(in[:off], '\n') + 1
+	if start == 0 && strings.HasPrefix(in, byteOrderMark) {
+		start = len(byteOrderMark)
+	}
+	return start
+}
+
+// lineEnding returns the line ending at off, or "" at the end of the input.
+func (p *sshParser) lineEnding(off int) string {
+	rest := p.lexer.input[off:]
+	switch {
+	case strings.HasPrefix(rest, "\r\n"):
+		return "\r\n"
+	case strings.HasPrefix(rest, "\n"):
+		return "\n"
+	}
+	return ""
+}
+
+// lineFormat returns the layout of the line of key and val. comment is the
+// trailing comment token, if any.
+func (p *sshParser) lineFormat(key, val, comment *token) lineFormat {
+	in := p.lexer.input
+	end := val.off + len(val.val)
+	if comment != nil {
+		end = comment.off + len(comment.val)
+	}
+	return lineFormat{
+		indent:       in[p.lineStart(key.off):key.off],
+		sep:          in[key.off+len(key.val) : val.off],
+		emptyComment: comment != nil && comment.val == "",
+		eol:          p.lineEnding(end),
+	}
+}
+
+// includeError reports the errors returned by newInclude for the Include
+// value val.
+func (p *sshParser) includeError(val *token, err error) {
+	for _, perr := range includeErrors(val.Position, err) {
+		p.record(perr)
 	}
-	// TODO this format is ugly
-	panic(tok.Position.String() + ": " + err.Error())
 }
 
 func (p *sshParser) run() {
-	for state := p.parseStart; state != nil; {
+	for state := p.parseStart; state != nil && p.err == nil; {
 		state = state()
 	}
 }
 
 func (p *sshParser) peek() *token {
-	if len(p.tokensBuffer) != 0 {
-		return &(p.tokensBuffer[0])
-	}
-
-	tok, ok := <-p.flow
-	if !ok {
-		return nil
+	if !p.peeked {
+		tok, ok := p.lexer.nextToken()
+		if !ok {
+			return nil
+		}
+		p.lookahead, p.peeked = tok, true
 	}
-	p.tokensBuffer = append(p.tokensBuffer, tok)
-	return &tok
+	return &p.lookahead
 }
 
 func (p *sshParser) getToken() *token {
-	if len(p.tokensBuffer) != 0 {
-		tok := p.tokensBuffer[0]
-		p.tokensBuffer = p.tokensBuffer[1:]
+	if p.peeked {
+		p.peeked = false
+		tok := p.lookahead
 		return &tok
 	}
-	tok, ok := <-p.flow
+	tok, ok := p.lexer.nextToken()
 	if !ok {
 		return nil
 	}
@@ -83,68 +166,87 @@ func (p *sshParser) parseStart() sshParserStateFn {
 	case tokenEOF:
 		return nil
 	default:
-		p.raiseErrorf(tok, fmt.Sprintf("unexpected token %q\n", tok))
+		p.raise(tok, KindSyntax, fmt.Errorf("unexpected token %q", tok))
+		p.getToken()
+		return p.parseStart
 	}
-	return nil
 }
 
 func (p *sshParser) parseKV() sshParserStateFn {
 	key := p.getToken()
 	hasEquals := false
 	val := p.getToken()
-	if val.typ == tokenEquals {
+	if val != nil && val.typ == tokenEquals {
 		hasEquals = true
 		val = p.getToken()
 	}
+	var commentTok *token
 	comment := ""
-	tok := p.peek()
-	if tok == nil {
-		tok = &token{typ: tokenEOF}
+	if tok := p.peek(); tok != nil && tok.typ == tokenComment && tok.Position.Line == key.Position.Line {
+		commentTok = p.getToken()
+		comment = commentTok.val
 	}
-	if tok.typ == tokenComment && tok.Position.Line == val.Position.Line {
-		tok = p.getToken()
-		comment = tok.val
+	if val == nil || (val.typ != tokenString && val.typ != tokenEOF) || strings.TrimSpace(val.val) == "" {
+		return p.fail(key, key, KindMissingValue, fmt.Errorf("missing value for %s", key.val))
 	}
+	format := p.lineFormat(key, val, commentTok)
+	// val.val at this point could be e.g. "example.com       "
+	shortval := strings.TrimRightFunc(val.val, unicode.IsSpace)
+	spaceAfterValue := val.val[len(shortval):]
 	if strings.ToLower(key.val) == "match" {
-		matchval := strings.TrimRightFunc(val.val, unicode.IsSpace)
-		spaceBeforeComment := val.val[len(matchval):]
+		criteria, err := ParseMatchCriteria(shortval)
+		var perr *ParseError
+		if err != nil {
+			perr = p.raise(val, KindBadMatch, fmt.Errorf("Invalid Match criteria: %w", err))
+		}
 		m := &Match{
-			Criteria:           matchval,
+			LeadingComments:    detachComments(p.currentNodes, format.indent),
+			Criteria:           criteria,
+			rawCriteria:        shortval,
+			parsedCriteria:     slices.Clone(criteria),
 			Nodes:              make([]Node, 0),
 			EOLComment:         comment,
-			spaceBeforeComment: spaceBeforeComment,
+			spaceBeforeComment: spaceAfterValue,
+			lineFormat:         format,
+			keyword:            key.val,
 			hasEquals:          hasEquals,
-			leadingSpace:       key.Position.Col - 1,
 			position:           key.Position,
+			err:                perr,
 		}
 		p.config.Blocks = append(p.config.Blocks, m)
 		p.config.hasMatch = true
 		p.currentNodes = &m.Nodes
 		return p.parseStart
 	}
-	if strings.ToLower(key.val) == "host" {
-		strPatterns := strings.Split(val.val, " ")
+	lkey := strings.ToLower(key.val)
+	var args []string
+	if !commandDirectives[lkey] {
+		var err error
+		if args, err = argvSplit(shortval); err != nil {
+			return p.fail(key, val, KindBadQuotes, fmt.Errorf("invalid quotes in %s value", key.val))
+		}
+	}
+	if lkey == "host" {
+		strPatterns := args
 		patterns := make([]*Pattern, 0)
 		for i := range strPatterns {
-			if strPatterns[i] == "" {
-				continue
-			}
 			pat, err := NewPattern(strPatterns[i])
 			if err != nil {
-				p.raiseErrorf(val, fmt.Sprintf("Invalid host pattern: %v", err))
-				return nil
+				p.raise(val, KindBadPattern, fmt.Errorf("Invalid host pattern: %w", err))
+				continue
 			}
 			patterns = append(patterns, pat)
 		}
-		// val.val at this point could be e.g. "example.com       "
-		hostval := strings.TrimRightFunc(val.val, unicode.IsSpace)
-		spaceBeforeComment := val.val[len(hostval):]
-		val.val = hostval
 		p.config.Hosts = append(p.config.Hosts, &Host{
+			LeadingComments:    detachComments(p.currentNodes, format.indent),
 			Patterns:           patterns,
 			Nodes:              make([]Node, 0),
 			EOLComment:         comment,
-			spaceBeforeComment: spaceBeforeComment,
+			spaceBeforeComment: spaceAfterValue,
+			rawPatterns:        shortval,
+			parsedPatterns:     slices.Clone(patterns),
+			lineFormat:         format,
+			keyword:            key.val,
 			hasEquals:          hasEquals,
 			position:           key.Position,
 		})
@@ -153,66 +255,115 @@ func (p *sshParser) parseKV() sshParserStateFn {
 		p.currentNodes = &host.Nodes
 		return p.parseStart
 	}
-	if strings.ToLower(key.val) == "include" {
-		inc, err := NewInclude(strings.Split(val.val, " "), hasEquals, key.Position, comment, p.system, p.depth+1)
-		if err == ErrDepthExceeded {
-			p.raiseError(val, err)
-			return nil
-		}
+	if lkey == "include" {
+		opts := p.opts
+		opts.depth++
+		inc, err := newInclude(args, hasEquals, key.Position, comment, opts)
 		if err != nil {
-			p.raiseErrorf(val, fmt.Sprintf("Error parsing Include directive: %v", err))
-			return nil
+			p.includeError(val, err)
+		}
+		if inc != nil {
+			if inc.lazy != nil {
+				inc.lazy.pos = val.Position
+			}
+			inc.rawDirectives = shortval
+			inc.spaceBeforeComment = spaceAfterValue
+			inc.lineFormat = format
+			inc.keyword = key.val
+			inc.LeadingComments = detachComments(p.currentNodes, format.indent)
+			*p.currentNodes = append(*p.currentNodes, inc)
 		}
-		*p.currentNodes = append(*p.currentNodes, inc)
 		return p.parseStart
 	}
-	shortval := strings.TrimRightFunc(val.val, unicode.IsSpace)
-	spaceAfterValue := val.val[len(shortval):]
 	kv := &KV{
 		Key:             key.val,
 		Value:           shortval,
 		spaceAfterValue: spaceAfterValue,
 		Comment:         comment,
+		LeadingComments: detachComments(p.currentNodes, format.indent),
+		lineFormat:      format,
 		hasEquals:       hasEquals,
-		leadingSpace:    key.Position.Col - 1,
 		position:        key.Position,
 	}
 	*p.currentNodes = append(*p.currentNodes, kv)
 	return p.parseStart
 }
 
+// detachComments removes from the end of nodes the lines that belong to the
+// line that follows them, which is indented by indent, and returns them. These
+// are the comment lines directly above it, unless they are indented further,
+// and the blank lines above those. A comment separated from the line by a
+// blank line stays where it is.
+func detachComments(nodes *[]Node, indent string) []*Empty {
+	i := len(*nodes)
+	for ; i > 0; i-- {
+		e, ok := (*nodes)[i-1].(*Empty)
+		if !ok || e.isBlank() || len(e.indent) > len(indent) {
+			break
+		}
+	}
+	for ; i > 0; i-- {
+		if e, ok := (*nodes)[i-1].(*Empty); !ok || !e.isBlank() {
+			break
+		}
+	}
+	if i == len(*nodes) {
+		return nil
+	}
+	comments := make([]*Empty, 0, len(*nodes)-i)
+	for _, node := range (*nodes)[i:] {
+		comments = append(comments, node.(*Empty))
+	}
+	*nodes = (*nodes)[:i]
+	return comments
+}
+
 func (p *sshParser) parseComment() sshParserStateFn {
-	comment := p.getToken()
-	*p.currentNodes = append(*p.currentNodes, &Empty{
-		Comment: comment.val,
+	tok := p.getToken()
+	in := p.lexer.input
+	indentEnd := tok.off
+	if tok.typ == tokenComment {
 		// account for the "#" as well
-		leadingSpace: comment.Position.Col - 2,
-		position:     comment.Position,
+		indentEnd--
+	}
+	*p.currentNodes = append(*p.currentNodes, &Empty{
+		Comment: tok.val,
+		lineFormat: lineFormat{
+			indent:       in[p.lineStart(tok.off):indentEnd],
+			emptyComment: tok.typ == tokenComment && tok.val == "",
+			eol:          p.lineEnding(tok.off + len(tok.val)),
+		},
+		position: tok.Position,
 	})
 	return p.parseStart
 }
 
-func parseSSH(flow chan token, system bool, depth uint8) *Config {
-	// Ensure we consume tokens to completion even if parser exits early
-	defer func() {
-		for range flow {
-		}
-	}()
-
+// parseSSH parses src. It stops at the first error, unless opts.tolerant is
+// set, in which case it returns the Config along with every error it found as
+// a ParseErrors.
+func parseSSH(src []byte, opts parseOptions) (*Config, error) {
 	result := newConfig()
 	result.position = Position{1, 1}
 	parser := &sshParser{
-		flow:          flow,
+		lexer:         lexSSH(src),
 		config:        result,
-		tokensBuffer:  make([]token, 0),
 		currentTable:  make([]string, 0),
 		seenTableKeys: make([]string, 0),
-		system:        system,
-		depth:         depth,
+		opts:          opts,
 	}
 	if len(result.Hosts) > 0 {
 		parser.currentNodes = &result.Hosts[0].Nodes
 	}
 	parser.run()
-	return result
+	result.synced = slices.Clone(result.Hosts)
+	in := parser.lexer.input
+	result.bom = strings.HasPrefix(in, byteOrderMark)
+	result.noFinalNewline = len(in) > 0 && !strings.HasSuffix(in, "\n")
+	switch {
+	case parser.err != nil:
+		return nil, parser.err
+	case len(parser.errs) > 0:
+		return result, parser.errs
+	}
+	return result, nil
 }
@@ -2,6 +2,10 @@ package ssh_config
 
 import (
 	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -22,3 +26,169 @@ func TestIOError(t *testing.T) {
 		t.Errorf("expected read error msg, got %v", err)
 	}
 }
+
+func TestParseErrorKinds(t *testing.T) {
+	tests := []struct {
+		input string
+		kind  ErrorKind
+		pos   Position
+	}{
+		{"Host foo\n  Port\n", KindMissingValue, Position{2, 3}},
+		{"Host foo\n  User =\n", KindMissingValue, Position{2, 3}},
+		{"Match bogus x\n", KindBadMatch, Position{1, 7}},
+		{"Include ~nonexistent-user-xyz/config\n", KindInclude, Position{1, 9}},
+	}
+	old := lookupUserHome
+	lookupUserHome = func(name string) (string, error) {
+		return "", errors.New("unknown user")
+	}
+	defer func() { lookupUserHome = old }()
+	for _, tt := range tests {
+		_, err := Decode(strings.NewReader(tt.input))
+		var perr *ParseError
+		if !errors.As(err, &perr) {
+			t.Errorf("Decode(%q): expected *ParseError, got %#v", tt.input, err)
+			continue
+		}
+		if perr.Kind != tt.kind || perr.Position != tt.pos || perr.Filename != "" {
+			t.Errorf("Decode(%q): got kind %v at %v, want %v at %v", tt.input, perr.Kind, perr.Position, tt.kind, tt.pos)
+		}
+	}
+}
+
+func TestParseErrorIncludedFile(t *testing.T) {
+	dir := t.TempDir()
+	inner := filepath.Join(dir, "inner")
+	if err := os.WriteFile(inner, []byte("Host a\n\tMatch bogus x\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	outer := filepath.Join(dir, "outer")
+	if err := os.WriteFile(outer, []byte("Include "+inner+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := parseFile(outer, dir, false)
+	var perr *ParseError
+	if !errors.As(err, &perr) {
+		t.Fatalf("expected *ParseError, got %#v", err)
+	}
+	if perr.Filename != inner || perr.Position != (Position{2, 8}) || perr.Kind != KindBadMatch {
+		t.Errorf("got %s at %v (%v), want the Match line in %s", perr.Filename, perr.Position, perr.Kind, inner)
+	}
+	if want := inner + ":2:8: Invalid Match criteria"; !strings.HasPrefix(err.Error(), want) {
+		t.Errorf("Error() = %q, want prefix %q", err.Error(), want)
+	}
+
+	_, err = parseFile(filepath.Join(dir, "missing"), dir, false)
+	if !errors.As(err, &perr) || perr.Kind != KindIO || !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("missing file: got %#v", err)
+	}
+}
+
+func TestDecodeTolerant(t *testing.T) {
+	dir := t.TempDir()
+	inner := filepath.Join(dir, "inner")
+	if err := os.WriteFile(inner, []byte("Host inner\n  User\n  Port 2200\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	input := "Include " + inner + "\n" +
+		"Host a\n" +
+		"  Port   # no value\n" +
+		"  User alice\n" +
+		"Match bogus x # typo\n" +
+		"  User nobody\n" +
+		"Host b\n" +
+		"  HostName =\n" +
+		"  User bob\n"
+	cfg, err := DecodeOptions{Tolerant: true}.DecodeBytes([]byte(input))
+	var perrs ParseErrors
+	if !errors.As(err, &perrs) {
+		t.Fatalf("expected ParseErrors, got %#v", err)
+	}
+	want := []struct {
+		filename string
+		kind     ErrorKind
+		pos      Position
+	}{
+		{inner, KindMissingValue, Position{2, 3}},
+		{"", KindMissingValue, Position{3, 3}},
+		{"", KindBadMatch, Position{5, 7}},
+		{"", KindMissingValue, Position{8, 3}},
+	}
+	if len(perrs) != len(want) {
+		t.Fatalf("got %d errors, want %d: %v", len(perrs), len(want), perrs.Unwrap())
+	}
+	for i, w := range want {
+		if perrs[i].Filename != w.filename || perrs[i].Kind != w.kind || perrs[i].Position != w.pos {
+			t.Errorf("error %d: got %s %v at %v, want %s %v at %v", i, perrs[i].Filename, perrs[i].Kind, perrs[i].Position, w.filename, w.kind, w.pos)
+		}
+	}
+	if cfg == nil {
+		t.Fatal("expected a Config")
+	}
+	if got := cfg.String(); got != input {
+		t.Errorf("round trip mismatch:\n%q\nwant:\n%q", got, input)
+	}
+	bad, ok := cfg.Blocks[1].(*Host).Nodes[0].(*BadLine)
+	if !ok || bad.Err != perrs[1] {
+		t.Errorf("expected the Port line to be a BadLine, got %#v", cfg.Blocks[1].(*Host).Nodes[0])
+	}
+
+	for host, user := range map[string]string{"a": "alice", "b": "bob"} {
+		res, err := cfg.Resolve(Context{HostArg: host})
+		if err != nil {
+			t.Fatalf("Resolve(%s): %v", host, err)
+		}
+		if got := res.Get("User"); got != user {
+			t.Errorf("Resolve(%s): User got %q, want %q", host, got, user)
+		}
+	}
+	if res, _ := cfg.Resolve(Context{HostArg: "inner"}); res.Get("Port") != "2200" {
+		t.Errorf("expected the included file to be kept")
+	}
+
+	if _, err := DecodeBytes([]byte(input)); !errors.As(err, new(*ParseError)) {
+		t.Errorf("strict decoding should stop at the first error, got %#v", err)
+	}
+}
+
+func TestLeadingComments(t *testing.T) {
+	input := "# file header\n\n# global\nCompression yes\n\nHost a\n  User alice\n\n  # the port\n  Port 2222\n  # Port 22\n\n# the b servers\nHost b\n  User bob\n# trailing\n"
+	cfg, err := Decode(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if got := cfg.String(); got != input {
+		t.Errorf("round trip mismatch:\n%q\nwant:\n%q", got, input)
+	}
+	lines := func(nodes ...Node) string {
+		var buf strings.Builder
+		for _, node := range nodes {
+			buf.WriteString(node.String() + "|")
+		}
+		return buf.String()
+	}
+	comments := func(comments []*Empty) string {
+		nodes := make([]Node, len(comments))
+		for i, e := range comments {
+			nodes[i] = e
+		}
+		return lines(nodes...)
+	}
+	global, a, b := cfg.Hosts[0], cfg.Hosts[1], cfg.Hosts[2]
+	tests := []struct {
+		what, got, want string
+	}{
+		{"global nodes", lines(global.Nodes...), "# file header|Compression yes|"},
+		{"Compression comments", comments(global.Nodes[1].(*KV).LeadingComments), "|# global|"},
+		{"Host a comments", comments(a.LeadingComments), "|"},
+		{"Host a nodes", lines(a.Nodes...), "  User alice|  Port 2222|  # Port 22|"},
+		{"Port comments", comments(a.Nodes[1].(*KV).LeadingComments), "|  # the port|"},
+		{"Host b comments", comments(b.LeadingComments), "|# the b servers|"},
+		{"Host b nodes", lines(b.Nodes...), "  User bob|# trailing|"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.what, tt.got, tt.want)
+		}
+	}
+}
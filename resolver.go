@@ -14,6 +14,8 @@ type resolveOptions struct {
 	strict       bool
 	finalPass    bool
 	canonicalize func(string) (string, bool, error)
+	hostResolver HostResolver
+	trace        func(TraceEvent)
 }
 
 // Strict enables strict validation using the OpenSSH client spec.
@@ -34,6 +36,7 @@ func FinalPass() ResolveOption {
 func Canonicalize(fn func(host string) (canonical string, changed bool, err error)) ResolveOption {
 	return func(o *resolveOptions) {
 		o.canonicalize = fn
+		o.hostResolver = nil
 	}
 }
 
@@ -56,6 +59,9 @@ func (u *UserSettings) Resolve(ctx Context, opts ...ResolveOption) (*Result, err
 	if u.onceErr != nil && !u.IgnoreErrors {
 		return nil, u.onceErr
 	}
+	if ctx.HomeDir == "" {
+		ctx.HomeDir = u.HomeDir
+	}
 	var configs []*Config
 	if u.customConfig != nil {
 		configs = []*Config{u.customConfig}
@@ -92,7 +98,19 @@ func resolveConfigs(ctx Context, opts []ResolveOption, configs []*Config) (*Resu
 		return nil, err
 	}
 
-	if options.canonicalize != nil {
+	if options.hostResolver != nil {
+		canonical, enabled, err := canonicalizeHost(effectiveHost(ctx, result.values), result, options.hostResolver)
+		if err != nil {
+			return nil, err
+		}
+		if enabled {
+			ctx.HostArg = canonical
+			result, err = resolvePass(ctx, passCanonical, configs, options, spec)
+			if err != nil {
+				return nil, err
+			}
+		}
+	} else if options.canonicalize != nil {
 		canonical, changed, err := options.canonicalize(ctx.HostArg)
 		if err != nil {
 			return nil, err
@@ -117,8 +135,14 @@ func resolveConfigs(ctx Context, opts []ResolveOption, configs []*Config) (*Resu
 }
 
 func resolvePass(ctx Context, pass passType, configs []*Config, options resolveOptions, spec *clientSpec) (*Result, error) {
+	if ctx.Exec != nil {
+		// Like ssh, run Match exec commands again in each pass, where the
+		// host name and settings they see may differ.
+		ctx.Exec = cachedExec(ctx.Exec)
+	}
 	state := &resolveState{
-		values: make(map[string][]string),
+		values:  make(map[string][]string),
+		origins: make(map[string][]Origin),
 	}
 	for _, cfg := range configs {
 		if cfg == nil {
@@ -129,44 +153,79 @@ func resolvePass(ctx Context, pass passType, configs []*Config, options resolveO
 		}
 	}
 	applyDefaults(state, ctx, spec)
-	return &Result{values: state.values}, nil
+	if err := applyAlgorithmModifiers(state, spec, options); err != nil {
+		return nil, err
+	}
+	if err := expandTildes(state, ctx, options); err != nil {
+		return nil, err
+	}
+	return &Result{values: state.values, origins: state.origins, ctx: ctx, spec: spec}, nil
 }
 
 type resolveState struct {
 	values        map[string][]string
+	origins       map[string][]Origin
 	ignoreUnknown string
+	// includes is the chain of Include directives leading to the config
+	// currently being resolved.
+	includes []IncludeStep
+}
+
+// origin returns an Origin for a directive in filename, recording the current
+// Include chain.
+func (s *resolveState) origin(filename string, block Block) Origin {
+	o := Origin{Filename: filename, Block: block}
+	if len(s.includes) > 0 {
+		o.Includes = append([]IncludeStep(nil), s.includes...)
+	}
+	return o
 }
 
 func resolveConfig(cfg *Config, ctx Context, pass passType, options resolveOptions, spec *clientSpec, state *resolveState, neverMatch bool) error {
 	blocks := cfg.effectiveBlocks()
 	for _, block := range blocks {
+		origin := state.origin(cfg.filename, block)
+		origin.Position = block.Pos()
 		switch b := block.(type) {
 		case *Host:
 			active := false
+			reason := includeNotMatched
 			if !neverMatch {
-				active = b.Matches(ctx.HostArg)
+				var negated *Pattern
+				active, negated = b.match(ctx.HostArg)
+				switch {
+				case negated != nil:
+					reason = fmt.Sprintf("negated pattern %s matched %q", negated, ctx.HostArg)
+				case !active:
+					reason = fmt.Sprintf("no pattern matched %q", ctx.HostArg)
+				default:
+					reason = ""
+				}
 			}
-			if err := resolveNodes(b.Nodes, active, ctx, pass, options, spec, state, neverMatch); err != nil {
+			options.traceBlock(pass, origin, active, reason)
+			if err := resolveNodes(b.Nodes, active, origin, ctx, pass, options, spec, state, neverMatch); err != nil {
 				return err
 			}
 		case *Match:
 			active := false
-			if !neverMatch {
-				criteria, err := parseMatchCriteria(b.Criteria)
+			reason := includeNotMatched
+			switch {
+			case neverMatch:
+			case b.invalid():
+				reason = "invalid Match criteria"
+			default:
+				ok, failed, err := evalMatch(b.Criteria, ctx, pass, options, spec, state)
 				if err != nil {
-					if options.strict {
-						return err
-					}
-					active = false
-				} else {
-					ok, err := evalMatch(criteria, ctx, pass, options, spec, state)
-					if err != nil {
-						return err
-					}
-					active = ok
+					return err
+				}
+				active = ok
+				reason = ""
+				if failed != nil {
+					reason = fmt.Sprintf("criterion %q did not match", failed.String())
 				}
 			}
-			if err := resolveNodes(b.Nodes, active, ctx, pass, options, spec, state, neverMatch); err != nil {
+			options.traceBlock(pass, origin, active, reason)
+			if err := resolveNodes(b.Nodes, active, origin, ctx, pass, options, spec, state, neverMatch); err != nil {
 				return err
 			}
 		}
@@ -174,23 +233,46 @@ func resolveConfig(cfg *Config, ctx Context, pass passType, options resolveOptio
 	return nil
 }
 
-func resolveNodes(nodes []Node, active bool, ctx Context, pass passType, options resolveOptions, spec *clientSpec, state *resolveState, neverMatch bool) error {
+// includeNotMatched is the trace reason for blocks in a file included from a
+// block that did not match.
+const includeNotMatched = "enclosing block of Include did not match"
+
+func resolveNodes(nodes []Node, active bool, origin Origin, ctx Context, pass passType, options resolveOptions, spec *clientSpec, state *resolveState, neverMatch bool) error {
 	for _, node := range nodes {
 		switch n := node.(type) {
-		case *Empty:
+		case *Empty, *BadLine:
 			continue
 		case *KV:
-			if err := applyDirective(n.Key, n.Value, active, ctx, pass, options, spec, state); err != nil {
-				return err
+			kvOrigin := origin
+			kvOrigin.Position = n.position
+			value, err := directiveValue(spec, n.Key, n.Value)
+			if err == nil && options.strict {
+				err = checkArgCount(spec, n.Key, n.Value)
+			}
+			if err == nil {
+				err = applyDirective(n.Key, value, active, kvOrigin, ctx, pass, options, spec, state)
+			}
+			if err != nil {
+				return fmt.Errorf("ssh_config: %s: %s: %v", kvOrigin, n.Key, err)
 			}
 		case *Include:
+			if errs := n.load(); errs != nil && !n.lazy.opts.tolerant {
+				return errs
+			}
 			includeNeverMatch := neverMatch || !active
 			for _, path := range n.matches {
 				cfg := n.files[path]
 				if cfg == nil {
 					continue
 				}
-				if err := resolveConfig(cfg, ctx, pass, options, spec, state, includeNeverMatch); err != nil {
+				state.includes = append(state.includes, IncludeStep{
+					Filename: origin.Filename,
+					Position: n.position,
+					Path:     path,
+				})
+				err := resolveConfig(cfg, ctx, pass, options, spec, state, includeNeverMatch)
+				state.includes = state.includes[:len(state.includes)-1]
+				if err != nil {
 					return err
 				}
 			}
@@ -201,26 +283,29 @@ func resolveNodes(nodes []Node, active bool, ctx Context, pass passType, options
 	return nil
 }
 
-func applyDirective(key, value string, active bool, ctx Context, pass passType, options resolveOptions, spec *clientSpec, state *resolveState) error {
+func applyDirective(key, value string, active bool, origin Origin, ctx Context, pass passType, options resolveOptions, spec *clientSpec, state *resolveState) error {
 	lkey := strings.ToLower(strings.TrimSpace(key))
 	directive := spec.byName[lkey]
 	if directive == nil {
-		if options.strict {
-			if matchesIgnoreUnknown(state.ignoreUnknown, lkey) {
-				return nil
-			}
-			return fmt.Errorf("ssh_config: unknown directive %q", key)
+		if options.strict && !matchesIgnoreUnknown(state.ignoreUnknown, lkey) {
+			return errors.New("unknown directive")
+		}
+		if active {
+			options.traceDirective(TraceSkipped, pass, origin, key, value, "unknown directive")
 		}
 		return nil
 	}
 	if directive.Status == "unsupported" {
 		if options.strict {
-			return fmt.Errorf("ssh_config: unsupported directive %q", key)
+			return errors.New("unsupported directive")
+		}
+		if active {
+			options.traceDirective(TraceSkipped, pass, origin, key, value, "unsupported directive")
 		}
 		return nil
 	}
 	if directive.Status == "deprecated" && directive.AliasFor == "" && options.strict {
-		return fmt.Errorf("ssh_config: deprecated directive %q", key)
+		return errors.New("deprecated directive")
 	}
 	if options.strict {
 		if err := validateValue(directive, value); err != nil {
@@ -235,38 +320,42 @@ func applyDirective(key, value string, active bool, ctx Context, pass passType,
 		canonical = directive.AliasFor
 	}
 	canonical = strings.ToLower(canonical)
-	if canonical == "ignoreunknown" {
-		if _, ok := state.values[canonical]; !ok {
-			state.values[canonical] = []string{value}
-			state.ignoreUnknown = value
-		}
-		return nil
-	}
 	if directive.Multi {
 		state.values[canonical] = append(state.values[canonical], value)
+		state.origins[canonical] = append(state.origins[canonical], origin)
+		options.traceDirective(TraceApplied, pass, origin, key, value, "")
+		return nil
+	}
+	if winners, ok := state.origins[canonical]; ok {
+		options.traceDirective(TraceSkipped, pass, origin, key, value, fmt.Sprintf("already set at %s", winners[0]))
 		return nil
 	}
-	if _, ok := state.values[canonical]; !ok {
-		state.values[canonical] = []string{value}
+	state.values[canonical] = []string{value}
+	state.origins[canonical] = []Origin{origin}
+	if canonical == "ignoreunknown" {
+		state.ignoreUnknown = value
 	}
+	options.traceDirective(TraceApplied, pass, origin, key, value, "")
 	return nil
 }
 
+// validateValue checks value against the type of directive. Its errors do
+// not name the directive.
 func validateValue(directive *specDirective, value string) error {
 	val := strings.TrimSpace(value)
 	switch directive.Type {
 	case "yesno":
 		lower := strings.ToLower(val)
 		if lower != "yes" && lower != "no" {
-			return fmt.Errorf("ssh_config: value for %q must be yes or no", directive.Name)
+			return errors.New("must be yes or no")
 		}
 	case "uint":
 		if val == "" {
-			return fmt.Errorf("ssh_config: value for %q must be an unsigned integer", directive.Name)
+			return errors.New("must be an unsigned integer")
 		}
 		for _, r := range val {
 			if r < '0' || r > '9' {
-				return fmt.Errorf("ssh_config: value for %q must be an unsigned integer", directive.Name)
+				return errors.New("must be an unsigned integer")
 			}
 		}
 	case "enum":
@@ -279,10 +368,34 @@ func validateValue(directive *specDirective, value string) error {
 				return nil
 			}
 		}
-		return fmt.Errorf("ssh_config: invalid value %q for %q", value, directive.Name)
-	case "list":
+		return fmt.Errorf("invalid value %q", val)
+	case "list", "commalist":
 		if val == "" {
-			return fmt.Errorf("ssh_config: value for %q must be non-empty", directive.Name)
+			return errors.New("must be non-empty")
+		}
+	case "port":
+		if !validPort(val) {
+			return errors.New("must be an unsigned integer from 1 to 65535")
+		}
+	case "time":
+		if directive.inEnum(val) {
+			return nil
+		}
+		if _, err := parseSSHDuration(val); err != nil {
+			return err
+		}
+	case "bytes":
+		if err := validateRekeyLimit(val); err != nil {
+			return err
+		}
+	case "enumpath":
+		if err := validateEnumPath(directive, val); err != nil {
+			return err
+		}
+	case "forward":
+		var fwd Forward
+		if err := fwd.UnmarshalText([]byte(val)); err != nil {
+			return err
 		}
 	}
 	return nil
@@ -305,18 +418,26 @@ func applyDefaults(state *resolveState, ctx Context, spec *clientSpec) {
 		if len(defaults) == 0 {
 			continue
 		}
-		if d.Multi {
-			state.values[key] = append([]string(nil), defaults...)
-		} else {
-			state.values[key] = []string{defaults[0]}
+		if !d.Multi {
+			defaults = defaults[:1]
 		}
+		setDefault(state, key, defaults...)
 	}
 	if _, ok := state.values["hostname"]; !ok && ctx.HostArg != "" {
-		state.values["hostname"] = []string{ctx.HostArg}
+		setDefault(state, "hostname", ctx.HostArg)
 	}
 	if _, ok := state.values["user"]; !ok && ctx.LocalUser != "" {
-		state.values["user"] = []string{ctx.LocalUser}
+		setDefault(state, "user", ctx.LocalUser)
+	}
+}
+
+func setDefault(state *resolveState, key string, values ...string) {
+	state.values[key] = append([]string(nil), values...)
+	origins := make([]Origin, len(values))
+	for i := range origins {
+		origins[i] = Origin{Default: true}
 	}
+	state.origins[key] = origins
 }
 
 func normalizeContext(ctx Context, spec *clientSpec) Context {
@@ -332,6 +453,9 @@ func normalizeContext(ctx Context, spec *clientSpec) Context {
 	if ctx.SessionType == "" {
 		ctx.SessionType = "shell"
 	}
+	if ctx.HomeDir == "" {
+		ctx.HomeDir = homedir()
+	}
 	return ctx
 }
 
@@ -360,148 +484,31 @@ func matchesIgnoreUnknown(patterns, key string) bool {
 	return matched
 }
 
-// Match criteria handling.
-
-type matchCriterion struct {
-	name   string
-	value  string
-	negate bool
-}
-
-func parseMatchCriteria(raw string) ([]matchCriterion, error) {
-	fields, err := tokenizeMatchCriteria(raw)
-	if err != nil {
-		return nil, err
-	}
-	if len(fields) == 0 {
-		return nil, fmt.Errorf("ssh_config: Match requires criteria")
-	}
-	criteria := make([]matchCriterion, 0, len(fields))
-	for i := 0; i < len(fields); i++ {
-		field := fields[i]
-		negate := strings.HasPrefix(field, "!")
-		if negate {
-			field = strings.TrimPrefix(field, "!")
-		}
-		name := strings.ToLower(field)
-		if name == "all" || name == "canonical" || name == "final" {
-			criteria = append(criteria, matchCriterion{name: name, negate: negate})
-			continue
-		}
-		arg := ""
-		if strings.Contains(field, "=") {
-			parts := strings.SplitN(field, "=", 2)
-			name = strings.ToLower(parts[0])
-			arg = parts[1]
-		} else {
-			if i+1 >= len(fields) {
-				return nil, fmt.Errorf("ssh_config: missing argument for Match %q", name)
-			}
-			arg = fields[i+1]
-			i++
-		}
-		criteria = append(criteria, matchCriterion{name: name, value: arg, negate: negate})
-	}
-	return criteria, nil
-}
-
-func tokenizeMatchCriteria(raw string) ([]string, error) {
-	fields := make([]string, 0, 8)
-	var field strings.Builder
-	inQuotes := false
-	escaped := false
-
-	flush := func() {
-		if field.Len() == 0 {
-			return
-		}
-		fields = append(fields, field.String())
-		field.Reset()
+// evalMatch reports whether criteria match. If they do not, it also returns
+// the first criterion that failed.
+func evalMatch(criteria []MatchCriterion, ctx Context, pass passType, options resolveOptions, spec *clientSpec, state *resolveState) (bool, *MatchCriterion, error) {
+	if err := validateMatchCriteria(criteria); err != nil {
+		return false, nil, err
 	}
-
-	for _, r := range raw {
-		if escaped {
-			switch r {
-			case ' ', '\t', '"', '\\':
-				field.WriteRune(r)
-			default:
-				field.WriteRune('\\')
-				field.WriteRune(r)
-			}
-			escaped = false
-			continue
-		}
-		switch r {
-		case '\\':
-			escaped = true
-		case '"':
-			inQuotes = !inQuotes
-		case ' ', '\t':
-			if inQuotes {
-				field.WriteRune(r)
-			} else {
-				flush()
-			}
-		default:
-			field.WriteRune(r)
-		}
-	}
-
-	if escaped {
-		field.WriteRune('\\')
-	}
-	if inQuotes {
-		return nil, fmt.Errorf("ssh_config: unterminated quoted Match criterion")
-	}
-
-	flush()
-	return fields, nil
-}
-
-func evalMatch(criteria []matchCriterion, ctx Context, pass passType, options resolveOptions, spec *clientSpec, state *resolveState) (bool, error) {
-	if len(criteria) == 0 {
-		return false, fmt.Errorf("ssh_config: Match requires criteria")
-	}
-	if err := validateMatchAll(criteria); err != nil {
-		return false, err
-	}
-	result := true
-	for _, c := range criteria {
-		if !result && c.name == "exec" {
+	var failed *MatchCriterion
+	for i, c := range criteria {
+		if failed != nil && strings.EqualFold(c.Name, "exec") {
 			continue
 		}
 		matched, err := evalCriterion(c, ctx, pass, options, spec, state)
 		if err != nil {
-			return false, err
-		}
-		if !matched {
-			result = false
-		}
-	}
-	return result, nil
-}
-
-func validateMatchAll(criteria []matchCriterion) error {
-	for i, c := range criteria {
-		if c.name != "all" {
-			continue
+			return false, nil, err
 		}
-		if len(criteria) == 1 {
-			return nil
+		if !matched && failed == nil {
+			failed = &criteria[i]
 		}
-		if len(criteria) == 2 && i == 1 {
-			if criteria[0].name == "canonical" || criteria[0].name == "final" {
-				return nil
-			}
-		}
-		return fmt.Errorf("ssh_config: Match all cannot be combined with other attributes")
 	}
-	return nil
+	return failed == nil, failed, nil
 }
 
-func evalCriterion(c matchCriterion, ctx Context, pass passType, options resolveOptions, spec *clientSpec, state *resolveState) (bool, error) {
-	negate := c.negate
-	switch c.name {
+func evalCriterion(c MatchCriterion, ctx Context, pass passType, options resolveOptions, spec *clientSpec, state *resolveState) (bool, error) {
+	negate := c.Negated
+	switch strings.ToLower(c.Name) {
 	case "all":
 		return applyNegation(true, negate), nil
 	case "canonical":
@@ -509,26 +516,24 @@ func evalCriterion(c matchCriterion, ctx Context, pass passType, options resolve
 	case "final":
 		return applyNegation(pass == passFinal, negate), nil
 	case "host":
-		host := effectiveHost(ctx, state)
-		matched, err := matchPatternList(host, c.value, true)
+		host := effectiveHost(ctx, state.values)
+		matched, err := matchPatternList(host, c.Arg, true)
 		return applyNegation(matched, negate), err
 	case "originalhost":
-		matched, err := matchPatternList(ctx.OriginalHost, c.value, true)
+		matched, err := matchPatternList(ctx.OriginalHost, c.Arg, true)
 		return applyNegation(matched, negate), err
 	case "user":
-		matched, err := matchPatternList(remoteUser(ctx, state), c.value, false)
+		matched, err := matchPatternList(remoteUser(ctx, state.values), c.Arg, false)
 		return applyNegation(matched, negate), err
 	case "localuser":
-		matched, err := matchPatternList(ctx.LocalUser, c.value, false)
+		matched, err := matchPatternList(ctx.LocalUser, c.Arg, false)
 		return applyNegation(matched, negate), err
 	case "localnetwork":
-		if ctx.LocalNetwork == nil {
-			if options.strict {
-				return false, fmt.Errorf("ssh_config: Match localnetwork requires LocalNetwork callback")
-			}
-			return false, nil
+		localNetwork := ctx.LocalNetwork
+		if localNetwork == nil {
+			localNetwork = LocalNetworkMatcher(nil)
 		}
-		ok, err := ctx.LocalNetwork(c.value)
+		ok, err := localNetwork(c.Arg)
 		if err != nil {
 			if options.strict {
 				return false, err
@@ -537,24 +542,24 @@ func evalCriterion(c matchCriterion, ctx Context, pass passType, options resolve
 		}
 		return applyNegation(ok, negate), nil
 	case "version":
-		matched, err := matchPatternList(ctx.Version, c.value, false)
+		matched, err := matchPatternList(ctx.Version, c.Arg, false)
 		return applyNegation(matched, negate), err
 	case "tagged":
 		tag := firstValue(state.values, "tag")
-		if tag == "" && c.value == "" {
+		if tag == "" && c.Arg == "" {
 			return applyNegation(true, negate), nil
 		}
-		matched, err := matchPatternList(tag, c.value, false)
+		matched, err := matchPatternList(tag, c.Arg, false)
 		return applyNegation(matched, negate), err
 	case "command":
-		if ctx.Command == "" && c.value == "" {
+		if ctx.Command == "" && c.Arg == "" {
 			return applyNegation(true, negate), nil
 		}
-		matched, err := matchPatternList(ctx.Command, c.value, false)
+		matched, err := matchPatternList(ctx.Command, c.Arg, false)
 		return applyNegation(matched, negate), err
 	case "sessiontype":
-		stype := sessionType(ctx, state)
-		matched, err := matchPatternList(stype, c.value, false)
+		stype := sessionType(ctx, state.values)
+		matched, err := matchPatternList(stype, c.Arg, false)
 		return applyNegation(matched, negate), err
 	case "exec":
 		if ctx.Exec == nil {
@@ -563,7 +568,7 @@ func evalCriterion(c matchCriterion, ctx Context, pass passType, options resolve
 			}
 			return false, nil
 		}
-		cmd, err := expandMatchExec(c.value, ctx, state, spec)
+		cmd, err := expandMatchExec(c.Arg, ctx, state.values, spec)
 		if err != nil {
 			if options.strict {
 				return false, err
@@ -580,7 +585,7 @@ func evalCriterion(c matchCriterion, ctx Context, pass passType, options resolve
 		return applyNegation(ok, negate), nil
 	default:
 		if options.strict {
-			return false, fmt.Errorf("ssh_config: unsupported Match attribute %q", c.name)
+			return false, fmt.Errorf("ssh_config: unsupported Match attribute %q", c.Name)
 		}
 		return false, nil
 	}
@@ -593,15 +598,15 @@ func applyNegation(value, negate bool) bool {
 	return value
 }
 
-func remoteUser(ctx Context, state *resolveState) string {
-	if user := firstValue(state.values, "user"); user != "" {
+func remoteUser(ctx Context, values map[string][]string) string {
+	if user := firstValue(values, "user"); user != "" {
 		return user
 	}
 	return ctx.LocalUser
 }
 
-func sessionType(ctx Context, state *resolveState) string {
-	if st := firstValue(state.values, "sessiontype"); st != "" {
+func sessionType(ctx Context, values map[string][]string) string {
+	if st := firstValue(values, "sessiontype"); st != "" {
 		return st
 	}
 	if ctx.Command != "" {
@@ -610,73 +615,23 @@ func sessionType(ctx Context, state *resolveState) string {
 	return ctx.SessionType
 }
 
-func effectiveHost(ctx Context, state *resolveState) string {
-	if hn := firstValue(state.values, "hostname"); hn != "" {
-		return expandHostName(hn, ctx.HostArg)
+func effectiveHost(ctx Context, values map[string][]string) string {
+	if hn := firstValue(values, "hostname"); hn != "" {
+		expanded, err := percentExpand(hn, hostNameTokens, hostNameTokenValues(ctx))
+		if err != nil {
+			return hn
+		}
+		return expanded
 	}
 	return ctx.HostArg
 }
 
-func expandHostName(value, hostArg string) string {
-	var b strings.Builder
-	for i := 0; i < len(value); i++ {
-		if value[i] != '%' {
-			b.WriteByte(value[i])
-			continue
-		}
-		if i+1 >= len(value) {
-			b.WriteByte('%')
-			continue
-		}
-		switch value[i+1] {
-		case '%':
-			b.WriteByte('%')
-		case 'h':
-			b.WriteString(hostArg)
-		default:
-			b.WriteByte('%')
-			b.WriteByte(value[i+1])
-		}
-		i++
-	}
-	return b.String()
-}
-
-func expandMatchExec(value string, ctx Context, state *resolveState, spec *clientSpec) (string, error) {
-	localHost, _ := os.Hostname()
-	shortHost := localHost
-	if idx := strings.Index(localHost, "."); idx > 0 {
-		shortHost = localHost[:idx]
-	}
-	port := resolvePort(state, spec)
-	remote := remoteUser(ctx, state)
-	jump := firstValue(state.values, "proxyjump")
-	if strings.EqualFold(jump, "none") {
-		jump = ""
-	}
-	host := effectiveHost(ctx, state)
-	keyAlias := firstValue(state.values, "hostkeyalias")
-	if keyAlias == "" {
-		keyAlias = host
-	}
-	uid := currentUID()
-	connHash := connectionHash(localHost, host, port, remote, jump)
-	values := map[string]string{
-		"%%": "%",
-		"%C": connHash,
-		"%L": shortHost,
-		"%d": currentHomeDir(),
-		"%h": host,
-		"%k": keyAlias,
-		"%l": localHost,
-		"%n": ctx.OriginalHost,
-		"%p": port,
-		"%r": remote,
-		"%u": ctx.LocalUser,
-		"%i": uid,
-		"%j": jump,
-	}
-	return expandTokens(value, values), nil
+func expandMatchExec(value string, ctx Context, values map[string][]string, spec *clientSpec) (string, error) {
+	expanded, err := percentExpand(value, spec.MatchExecTokens, percentTokens(ctx, values, spec))
+	if err != nil {
+		return "", fmt.Errorf("ssh_config: Match exec: %v", err)
+	}
+	return expanded, nil
 }
 
 func connectionHash(localHost, host, port, user, jump string) string {
@@ -689,28 +644,6 @@ func connectionHash(localHost, host, port, user, jump string) string {
 	return hex.EncodeToString(h.Sum(nil))
 }
 
-func expandTokens(value string, values map[string]string) string {
-	var b strings.Builder
-	for i := 0; i < len(value); i++ {
-		if value[i] != '%' {
-			b.WriteByte(value[i])
-			continue
-		}
-		if i+1 >= len(value) {
-			b.WriteByte('%')
-			continue
-		}
-		token := value[i : i+2]
-		if repl, ok := values[token]; ok {
-			b.WriteString(repl)
-		} else {
-			b.WriteString(token)
-		}
-		i++
-	}
-	return b.String()
-}
-
 func currentUID() string {
 	usr, err := osuser.Current()
 	if err == nil && usr != nil {
@@ -719,16 +652,8 @@ func currentUID() string {
 	return ""
 }
 
-func currentHomeDir() string {
-	home, err := os.UserHomeDir()
-	if err == nil {
-		return home
-	}
-	return ""
-}
-
-func resolvePort(state *resolveState, spec *clientSpec) string {
-	if port := firstValue(state.values, "port"); port != "" {
+func resolvePort(values map[string][]string, spec *clientSpec) string {
+	if port := firstValue(values, "port"); port != "" {
 		return port
 	}
 	if spec != nil {
@@ -119,6 +119,22 @@ func TestResolveStrictUintValidation(t *testing.T) {
 	}
 }
 
+func TestResolveStrictValueErrorPosition(t *testing.T) {
+	input := "Host a\n  ConnectTimeout 5x\n"
+	cfg, err := Decode(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	_, err = cfg.Resolve(Context{HostArg: "a"}, Strict())
+	if err == nil {
+		t.Fatal("expected invalid time error")
+	}
+	want := `ssh_config: <config>:2:3 (Host a): ConnectTimeout: invalid time "5x"`
+	if err.Error() != want {
+		t.Errorf("got %q, want %q", err, want)
+	}
+}
+
 func TestResolveDeprecatedAliasDirective(t *testing.T) {
 	input := "Host *\n  PubkeyAcceptedKeyTypes ssh-ed25519\n"
 	cfg, err := Decode(bytes.NewReader([]byte(input)))
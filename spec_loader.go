@@ -27,10 +27,13 @@ type clientSpec struct {
 
 type specDirective struct {
 	Name         string      `json:"name"`
+	Display      string      `json:"display"`
 	Canonical    string      `json:"canonical"`
 	Status       string      `json:"status"`
 	Type         string      `json:"type"`
 	Multi        bool        `json:"multi"`
+	MinArgs      int         `json:"minArgs"`
+	MaxArgs      int         `json:"maxArgs"` // -1 for any number
 	Default      interface{} `json:"default"`
 	AliasFor     string      `json:"aliasFor"`
 	Enum         []string    `json:"enum"`
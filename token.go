@@ -6,6 +6,7 @@ type token struct {
 	Position
 	typ tokenType
 	val string
+	off int // byte offset of val in the input
 }
 
 func (t token) String() string {
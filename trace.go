@@ -0,0 +1,96 @@
+package ssh_config
+
+// TraceEventKind identifies the decision recorded by a TraceEvent.
+type TraceEventKind int
+
+const (
+	// TraceBlock is reported for every Host or Match block visited by
+	// Resolve, whether or not it matched.
+	TraceBlock TraceEventKind = iota
+	// TraceApplied is reported when a directive in a matching block sets a
+	// value.
+	TraceApplied
+	// TraceSkipped is reported when a directive in a matching block is
+	// ignored, for example because an earlier value won.
+	TraceSkipped
+)
+
+// String returns the name of k.
+func (k TraceEventKind) String() string {
+	switch k {
+	case TraceBlock:
+		return "block"
+	case TraceApplied:
+		return "applied"
+	case TraceSkipped:
+		return "skipped"
+	}
+	return "unknown"
+}
+
+// TraceEvent describes a single decision made during Resolve.
+type TraceEvent struct {
+	Kind TraceEventKind
+	// Pass is the evaluation pass: "initial", "canonical" or "final".
+	Pass string
+	// Origin locates the block (for TraceBlock) or the directive.
+	Origin Origin
+	// Matched reports whether the block matched. It is only set for
+	// TraceBlock events.
+	Matched bool
+	// Reason explains why a block did not match or why a directive was
+	// skipped, for example the Match criterion that failed.
+	Reason string
+	// Key and Value hold the directive for TraceApplied and TraceSkipped
+	// events.
+	Key   string
+	Value string
+}
+
+// Trace calls fn for every block evaluated and every directive applied or
+// skipped during Resolve. Events are reported in evaluation order; when
+// several passes run, the events of every pass are reported.
+func Trace(fn func(TraceEvent)) ResolveOption {
+	return func(o *resolveOptions) {
+		o.trace = fn
+	}
+}
+
+func (p passType) String() string {
+	switch p {
+	case passInitial:
+		return "initial"
+	case passCanonical:
+		return "canonical"
+	case passFinal:
+		return "final"
+	}
+	return "unknown"
+}
+
+func (o *resolveOptions) traceBlock(pass passType, origin Origin, matched bool, reason string) {
+	if o.trace == nil {
+		return
+	}
+	o.trace(TraceEvent{
+		Kind:    TraceBlock,
+		Pass:    pass.String(),
+		Origin:  origin,
+		Matched: matched,
+		Reason:  reason,
+	})
+}
+
+func (o *resolveOptions) traceDirective(kind TraceEventKind, pass passType, origin Origin, key, value, reason string) {
+	if o.trace == nil {
+		return
+	}
+	o.trace(TraceEvent{
+		Kind:   kind,
+		Pass:   pass.String(),
+		Origin: origin,
+		Reason: reason,
+		Key:    key,
+		Value:  value,
+	})
+}
@@ -0,0 +1,101 @@
+package ssh_config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestResolveTrace(t *testing.T) {
+	input := "Host !db.example.com *.example.com\n  User negated\nHost other\n  User other\nMatch host=*.example.com user=nobody\n  User match\nHost *.example.com\n  User first\n  Port 2200\nHost *\n  User second\n  Bogus value\n"
+	cfg, err := Decode(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	var events []TraceEvent
+	_, err = cfg.Resolve(Context{HostArg: "db.example.com", LocalUser: "local"}, Trace(func(ev TraceEvent) {
+		events = append(events, ev)
+	}))
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+
+	var blocks []TraceEvent
+	for _, ev := range events {
+		if ev.Kind == TraceBlock {
+			blocks = append(blocks, ev)
+		}
+	}
+	// The implicit Host * block, four Host blocks and one Match block.
+	if len(blocks) != 6 {
+		t.Fatalf("got %d block events, want 6: %+v", len(blocks), blocks)
+	}
+	wantBlocks := []struct {
+		line    int
+		matched bool
+		reason  string
+	}{
+		{1, true, ""},
+		{1, false, `negated pattern !db.example.com matched "db.example.com"`},
+		{3, false, `no pattern matched "db.example.com"`},
+		{5, false, `criterion "user nobody" did not match`},
+		{7, true, ""},
+		{10, true, ""},
+	}
+	for i, want := range wantBlocks {
+		got := blocks[i]
+		if got.Origin.Position.Line != want.line || got.Matched != want.matched || got.Reason != want.reason {
+			t.Errorf("block %d: got line %d matched %v reason %q, want line %d matched %v reason %q",
+				i, got.Origin.Position.Line, got.Matched, got.Reason, want.line, want.matched, want.reason)
+		}
+		if got.Pass != "initial" {
+			t.Errorf("block %d: Pass got %q, want initial", i, got.Pass)
+		}
+	}
+
+	var applied, skipped []TraceEvent
+	for _, ev := range events {
+		switch ev.Kind {
+		case TraceApplied:
+			applied = append(applied, ev)
+		case TraceSkipped:
+			skipped = append(skipped, ev)
+		}
+	}
+	if len(applied) != 2 || applied[0].Value != "first" || applied[1].Key != "Port" {
+		t.Errorf("applied events got %+v", applied)
+	}
+	if len(skipped) != 2 {
+		t.Fatalf("skipped events got %+v, want 2", skipped)
+	}
+	if skipped[0].Value != "second" || skipped[0].Reason != "already set at <config>:8:3 (Host *.example.com)" {
+		t.Errorf("skipped User got %+v", skipped[0])
+	}
+	if skipped[1].Key != "Bogus" || skipped[1].Reason != "unknown directive" {
+		t.Errorf("skipped Bogus got %+v", skipped[1])
+	}
+}
+
+func TestResolveTraceIncludeNotMatched(t *testing.T) {
+	inc := &Include{
+		matches: []string{"included"},
+		files: map[string]*Config{
+			"included": {Blocks: []Block{&Host{Patterns: []*Pattern{matchAll}, Nodes: []Node{&KV{Key: "User", Value: "inc"}}}}},
+		},
+	}
+	cfg := &Config{Blocks: []Block{&Host{Patterns: []*Pattern{mustPattern(t, "nomatch")}, Nodes: []Node{inc}}}}
+	var events []TraceEvent
+	if _, err := cfg.Resolve(Context{HostArg: "example.com", LocalUser: "local"}, Trace(func(ev TraceEvent) {
+		events = append(events, ev)
+	})); err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want 2: %+v", len(events), events)
+	}
+	if events[1].Matched || events[1].Reason != includeNotMatched {
+		t.Errorf("included block event got %+v", events[1])
+	}
+	if len(events[1].Origin.Includes) != 1 {
+		t.Errorf("included block origin got %+v", events[1].Origin)
+	}
+}
@@ -0,0 +1,197 @@
+package ssh_config
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// typedValue returns the first value for key after checking that the spec
+// type of key is one of types. ok is false if key has no value.
+func (r *Result) typedValue(key string, types ...string) (value string, d *specDirective, ok bool, err error) {
+	d, err = r.directive(key)
+	if err != nil {
+		return "", nil, false, err
+	}
+	found := false
+	for _, t := range types {
+		if d.Type == t {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return "", nil, false, fmt.Errorf("ssh_config: %s is a %s directive, not %s", key, d.Type, strings.Join(types, " or "))
+	}
+	vals := r.GetAll(key)
+	if len(vals) == 0 {
+		return "", d, false, nil
+	}
+	return strings.TrimSpace(vals[0]), d, true, nil
+}
+
+func (r *Result) directive(key string) (*specDirective, error) {
+	spec := r.spec
+	if spec == nil {
+		var err error
+		if spec, err = loadClientSpec(); err != nil {
+			return nil, err
+		}
+	}
+	d := spec.lookupDirective(key)
+	if d == nil {
+		return nil, fmt.Errorf("ssh_config: unknown directive %q", key)
+	}
+	return d, nil
+}
+
+// GetBool returns the value of a yes/no directive, such as BatchMode, or of
+// an enum directive whose value is yes, no, true or false, such as
+// StrictHostKeyChecking. It returns false if key has no value.
+func (r *Result) GetBool(key string) (bool, error) {
+	val, _, ok, err := r.typedValue(key, "yesno", "enum")
+	if err != nil || !ok {
+		return false, err
+	}
+	switch strings.ToLower(val) {
+	case "yes", "true":
+		return true, nil
+	case "no", "false":
+		return false, nil
+	}
+	return false, fmt.Errorf("ssh_config: %s: %q is not yes or no", key, val)
+}
+
+// GetUint returns the value of an unsigned integer directive, such as Port or
+// ServerAliveCountMax. It returns 0 if key has no value.
+func (r *Result) GetUint(key string) (uint, error) {
+	val, _, ok, err := r.typedValue(key, "uint", "port")
+	if err != nil || !ok {
+		return 0, err
+	}
+	n, err := strconv.ParseUint(val, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("ssh_config: %s: %q is not an unsigned integer", key, val)
+	}
+	return uint(n), nil
+}
+
+// GetDuration returns the value of a time directive, such as ConnectTimeout
+// or ServerAliveInterval, in the OpenSSH time format: a number of seconds or a
+// sequence of numbers with s, m, h, d or w units, such as 1h30m. It returns 0
+// if key has no value.
+func (r *Result) GetDuration(key string) (time.Duration, error) {
+	val, _, ok, err := r.typedValue(key, "time", "uint")
+	if err != nil || !ok {
+		return 0, err
+	}
+	dur, err := parseSSHDuration(val)
+	if err != nil {
+		return 0, fmt.Errorf("ssh_config: %s: %v", key, err)
+	}
+	return dur, nil
+}
+
+// GetEnum returns the value of an enum directive, such as ControlMaster or
+// AddressFamily, spelled as in the spec. It fails if the value is not one of
+// the values the directive accepts, and returns an empty string if key has no
+// value.
+func (r *Result) GetEnum(key string) (string, error) {
+	val, d, ok, err := r.typedValue(key, "enum")
+	if err != nil || !ok {
+		return "", err
+	}
+	for _, entry := range d.Enum {
+		if strings.EqualFold(entry, val) {
+			return entry, nil
+		}
+	}
+	return "", fmt.Errorf("ssh_config: %s: %q is not one of %s", key, val, strings.Join(d.Enum, ", "))
+}
+
+// GetList returns the values of key split into items. Algorithm lists and
+// ProxyJump are split on commas, and ProxyJump none yields no items.
+// Directives that take several arguments, such as UserKnownHostsFile and
+// SendEnv, are split on whitespace. For other directives, each value is one
+// item, so GetList("IdentityFile") is equivalent to GetAll.
+func (r *Result) GetList(key string) ([]string, error) {
+	d, err := r.directive(key)
+	if err != nil {
+		return nil, err
+	}
+	switch d.Type {
+	case "yesno", "uint", "port", "enum":
+		return nil, fmt.Errorf("ssh_config: %s is a %s directive, not a list", key, d.Type)
+	}
+	return listItems(d, r.rawValues(key)), nil
+}
+
+// listItems splits the values of d into items according to its spec type.
+// See GetList.
+func listItems(d *specDirective, vals []string) []string {
+	name := strings.ToLower(d.Name)
+	var out []string
+	for _, val := range vals {
+		switch {
+		case name == "proxyjump" && strings.EqualFold(strings.TrimSpace(val), "none"):
+			// ProxyJump none disables jumping.
+		case d.Type == "commalist":
+			for _, item := range strings.Split(val, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					out = append(out, item)
+				}
+			}
+		case d.Type == "list":
+			out = append(out, splitArgs(val)...)
+		default:
+			out = append(out, val)
+		}
+	}
+	return out
+}
+
+// parseSSHDuration parses a time in the format of OpenSSH's convtime.
+func parseSSHDuration(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, fmt.Errorf("empty time")
+	}
+	var total time.Duration
+	for rest := s; rest != ""; {
+		i := 0
+		for i < len(rest) && rest[i] >= '0' && rest[i] <= '9' {
+			i++
+		}
+		if i == 0 {
+			return 0, fmt.Errorf("invalid time %q", s)
+		}
+		n, err := strconv.ParseInt(rest[:i], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid time %q", s)
+		}
+		rest = rest[i:]
+		unit := time.Second
+		if rest != "" {
+			switch rest[0] {
+			case 's', 'S':
+			case 'm', 'M':
+				unit = time.Minute
+			case 'h', 'H':
+				unit = time.Hour
+			case 'd', 'D':
+				unit = 24 * time.Hour
+			case 'w', 'W':
+				unit = 7 * 24 * time.Hour
+			default:
+				return 0, fmt.Errorf("invalid time %q", s)
+			}
+			rest = rest[1:]
+		}
+		if n > int64(math.MaxInt64/unit) || time.Duration(n)*unit > math.MaxInt64-total {
+			return 0, fmt.Errorf("time %q is too large", s)
+		}
+		total += time.Duration(n) * unit
+	}
+	return total, nil
+}
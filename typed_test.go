@@ -0,0 +1,119 @@
+package ssh_config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResultTypedAccessors(t *testing.T) {
+	input := `Host *
+  BatchMode yes
+  StrictHostKeyChecking false
+  ControlMaster AUTO
+  Port 2222
+  ConnectionAttempts 3
+  ConnectTimeout 1m30s
+  ServerAliveInterval 15
+  Ciphers aes256-gcm@openssh.com, chacha20-poly1305@openssh.com
+  ProxyJump jump1,jump2:2200
+  UserKnownHostsFile /a/known_hosts /b/known_hosts
+  SendEnv LANG LC_*
+  SendEnv EDITOR
+  IdentityFile /keys/one
+  IdentityFile /keys/two
+`
+	res := resolveString(t, input, Context{HostArg: "web", LocalUser: "local", HomeDir: "/home/fixture"})
+
+	for key, want := range map[string]bool{"BatchMode": true, "StrictHostKeyChecking": false, "ForwardX11Trusted": false} {
+		got, err := res.GetBool(key)
+		if err != nil || got != want {
+			t.Errorf("GetBool(%q) got %v, %v, want %v", key, got, err, want)
+		}
+	}
+	for key, want := range map[string]uint{"Port": 2222, "ConnectionAttempts": 3} {
+		got, err := res.GetUint(key)
+		if err != nil || got != want {
+			t.Errorf("GetUint(%q) got %v, %v, want %v", key, got, err, want)
+		}
+	}
+	for key, want := range map[string]time.Duration{"ConnectTimeout": 90 * time.Second, "ServerAliveInterval": 15 * time.Second} {
+		got, err := res.GetDuration(key)
+		if err != nil || got != want {
+			t.Errorf("GetDuration(%q) got %v, %v, want %v", key, got, err, want)
+		}
+	}
+	if got, err := res.GetEnum("ControlMaster"); err != nil || got != "auto" {
+		t.Errorf("GetEnum(ControlMaster) got %q, %v", got, err)
+	}
+
+	lists := []struct {
+		key  string
+		want []string
+	}{
+		{"Ciphers", []string{"aes256-gcm@openssh.com", "chacha20-poly1305@openssh.com"}},
+		{"ProxyJump", []string{"jump1", "jump2:2200"}},
+		{"UserKnownHostsFile", []string{"/a/known_hosts", "/b/known_hosts"}},
+		{"SendEnv", []string{"LANG", "LC_*", "EDITOR"}},
+		{"IdentityFile", []string{"/keys/one", "/keys/two"}},
+		{"RemoteCommand", nil},
+	}
+	for _, tt := range lists {
+		got, err := res.GetList(tt.key)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("GetList(%q) got %q, %v, want %q", tt.key, got, err, tt.want)
+		}
+	}
+}
+
+func TestResultTypedAccessorErrors(t *testing.T) {
+	input := "Host *\n  Compression maybe\n  Port 22x\n  ConnectTimeout 5x\n  AddressFamily inet7\n"
+	res := resolveString(t, input, Context{HostArg: "web", LocalUser: "local"})
+	tests := []struct {
+		name string
+		fn   func() error
+		want string
+	}{
+		{"bool value", func() error { _, err := res.GetBool("Compression"); return err }, `Compression: "maybe" is not yes or no`},
+		{"bool type", func() error { _, err := res.GetBool("Port"); return err }, "Port is a port directive, not yesno or enum"},
+		{"uint value", func() error { _, err := res.GetUint("Port"); return err }, `Port: "22x" is not an unsigned integer`},
+		{"duration value", func() error { _, err := res.GetDuration("ConnectTimeout"); return err }, `ConnectTimeout: invalid time "5x"`},
+		{"uint string type", func() error { _, err := res.GetUint("User"); return err }, "User is a string directive, not uint or port"},
+		{"duration string type", func() error { _, err := res.GetDuration("HostName"); return err }, "HostName is a string directive, not time or uint"},
+		{"enum value", func() error { _, err := res.GetEnum("AddressFamily"); return err }, `AddressFamily: "inet7" is not one of inet, inet6, any`},
+		{"list type", func() error { _, err := res.GetList("BatchMode"); return err }, "BatchMode is a yesno directive, not a list"},
+		{"unknown", func() error { _, err := res.GetBool("NoSuchThing"); return err }, `unknown directive "NoSuchThing"`},
+	}
+	for _, tt := range tests {
+		err := tt.fn()
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: got error %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestParseSSHDuration(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+		ok   bool
+	}{
+		{"0", 0, true},
+		{"90", 90 * time.Second, true},
+		{"1h30m", 90 * time.Minute, true},
+		{"1w2D3s", (7*24+2*24)*time.Hour + 3*time.Second, true},
+		{"10M", 10 * time.Minute, true},
+		{"", 0, false},
+		{"m", 0, false},
+		{"-5", 0, false},
+		{"1x", 0, false},
+		{"99999999999999999w", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := parseSSHDuration(tt.in)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("parseSSHDuration(%q) got %v, %v", tt.in, got, err)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package ssh_config
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// Unmarshal stores the values of r in the struct pointed to by v. Each
+// exported field with an ssh tag, such as `ssh:"ConnectTimeout"`, is filled
+// from the named directive; fields whose directive has no value keep their
+// current value. Untagged fields and fields tagged `ssh:"-"` are ignored, and
+// untagged embedded structs are filled recursively.
+//
+// Fields may be strings, bools, integers, time.Duration, []string, or types
+// implementing encoding.TextUnmarshaler and slices of them. Slices receive
+// the items returned by GetList; strings and TextUnmarshalers receive the
+// value expanded as by GetExpanded. A tag naming a directive that is not in
+// the embedded OpenSSH spec, or a field of an unsupported type, is an error
+// even if the directive has no value.
+func (r *Result) Unmarshal(v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("ssh_config: Unmarshal needs a non-nil pointer to a struct, got %T", v)
+	}
+	if err := r.checkFields(rv.Elem().Type()); err != nil {
+		return err
+	}
+	return r.decode(rv.Elem())
+}
+
+// fieldKey returns the directive name of field, or false if field is not
+// decoded.
+func fieldKey(field reflect.StructField) (string, bool) {
+	key, ok := field.Tag.Lookup("ssh")
+	if !ok || key == "-" || !field.IsExported() {
+		return "", false
+	}
+	return key, true
+}
+
+func isEmbeddedStruct(field reflect.StructField) bool {
+	_, tagged := field.Tag.Lookup("ssh")
+	return field.Anonymous && !tagged && field.Type.Kind() == reflect.Struct
+}
+
+// checkFields validates the tags and types of the fields of rt.
+func (r *Result) checkFields(rt reflect.Type) error {
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if isEmbeddedStruct(field) {
+			if err := r.checkFields(field.Type); err != nil {
+				return err
+			}
+			continue
+		}
+		key, ok := fieldKey(field)
+		if !ok {
+			continue
+		}
+		if _, err := r.directive(key); err != nil {
+			return fmt.Errorf("ssh_config: field %s: unknown directive %q", field.Name, key)
+		}
+		if !supportedFieldType(field.Type) {
+			return fmt.Errorf("ssh_config: field %s: unsupported type %s", field.Name, field.Type)
+		}
+	}
+	return nil
+}
+
+func supportedFieldType(t reflect.Type) bool {
+	if t == durationType || reflect.PointerTo(t).Implements(textUnmarshalerType) {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	case reflect.Slice:
+		elem := t.Elem()
+		return elem.Kind() == reflect.String || reflect.PointerTo(elem).Implements(textUnmarshalerType)
+	}
+	return false
+}
+
+// decode fills the fields of the struct rv that have an ssh tag.
+func (r *Result) decode(rv reflect.Value) error {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if isEmbeddedStruct(field) {
+			if err := r.decode(rv.Field(i)); err != nil {
+				return err
+			}
+			continue
+		}
+		key, ok := fieldKey(field)
+		if !ok {
+			continue
+		}
+		if err := r.decodeField(key, rv.Field(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Result) decodeField(key string, fv reflect.Value) error {
+	d, err := r.directive(key)
+	if err != nil {
+		return err
+	}
+	if len(r.GetAll(d.Name)) == 0 {
+		return nil
+	}
+	ft := fv.Type()
+	switch {
+	case ft == durationType:
+		dur, err := r.GetDuration(key)
+		if err != nil {
+			return err
+		}
+		fv.SetInt(int64(dur))
+		return nil
+	case reflect.PointerTo(ft).Implements(textUnmarshalerType):
+		// Forwards are split again, so they are passed on quoted.
+		vals, err := r.rawExpanded(key)
+		if err != nil {
+			return err
+		}
+		return unmarshalText(key, fv, vals[0])
+	}
+	switch ft.Kind() {
+	case reflect.String:
+		var val string
+		if d.Type == "enum" {
+			val, err = r.GetEnum(key)
+		} else {
+			val, err = r.GetExpanded(key)
+		}
+		if err != nil {
+			return err
+		}
+		fv.SetString(val)
+	case reflect.Bool:
+		b, err := r.GetBool(key)
+		if err != nil {
+			return err
+		}
+		fv.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := r.GetUint(key)
+		if err != nil {
+			return err
+		}
+		if fv.OverflowInt(int64(n)) {
+			return fmt.Errorf("ssh_config: %s: %d overflows %s", key, n, ft)
+		}
+		fv.SetInt(int64(n))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := r.GetUint(key)
+		if err != nil {
+			return err
+		}
+		if fv.OverflowUint(uint64(n)) {
+			return fmt.Errorf("ssh_config: %s: %d overflows %s", key, n, ft)
+		}
+		fv.SetUint(uint64(n))
+	case reflect.Slice:
+		return r.decodeList(key, d, fv)
+	default:
+		return fmt.Errorf("ssh_config: %s: unsupported field type %s", key, ft)
+	}
+	return nil
+}
+
+func (r *Result) decodeList(key string, d *specDirective, fv reflect.Value) error {
+	elem := fv.Type().Elem()
+	isText := reflect.PointerTo(elem).Implements(textUnmarshalerType)
+	if elem.Kind() != reflect.String && !isText {
+		return fmt.Errorf("ssh_config: %s: unsupported field type %s", key, fv.Type())
+	}
+	if _, err := r.GetList(key); err != nil {
+		return err
+	}
+	vals, err := r.rawExpanded(key)
+	if err != nil {
+		return err
+	}
+	items := listItems(d, vals)
+	out := reflect.MakeSlice(fv.Type(), len(items), len(items))
+	for i, item := range items {
+		if isText {
+			if err := unmarshalText(key, out.Index(i), item); err != nil {
+				return err
+			}
+			continue
+		}
+		out.Index(i).SetString(item)
+	}
+	fv.Set(out)
+	return nil
+}
+
+func unmarshalText(key string, fv reflect.Value, val string) error {
+	u := fv.Addr().Interface().(encoding.TextUnmarshaler)
+	if err := u.UnmarshalText([]byte(val)); err != nil {
+		return fmt.Errorf("ssh_config: %s: %v", key, err)
+	}
+	return nil
+}
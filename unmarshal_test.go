@@ -0,0 +1,97 @@
+package ssh_config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testLogLevel int
+
+func (l *testLogLevel) UnmarshalText(text []byte) error {
+	switch strings.ToUpper(string(text)) {
+	case "INFO":
+		*l = 1
+	case "DEBUG":
+		*l = 2
+	default:
+		return fmt.Errorf("unknown level %q", text)
+	}
+	return nil
+}
+
+type testKeepalive struct {
+	Interval time.Duration `ssh:"ServerAliveInterval"`
+	CountMax uint8         `ssh:"ServerAliveCountMax"`
+}
+
+type testSettings struct {
+	testKeepalive
+	Timeout   time.Duration  `ssh:"ConnectTimeout"`
+	Port      uint16         `ssh:"Port"`
+	Batch     bool           `ssh:"BatchMode"`
+	Keys      []string       `ssh:"IdentityFile"`
+	Level     testLogLevel   `ssh:"LogLevel"`
+	Levels    []testLogLevel `ssh:"LogLevel"`
+	User      string         `ssh:"User"`
+	Untouched string         `ssh:"RemoteCommand"`
+	Ignored   string         `ssh:"-"`
+	Plain     string
+}
+
+func TestResultUnmarshal(t *testing.T) {
+	input := "Host *\n  ConnectTimeout 10\n  ServerAliveInterval 1m\n  ServerAliveCountMax 4\n  Port 2022\n  BatchMode yes\n  IdentityFile /k/a\n  IdentityFile /k/b\n  LogLevel debug\n"
+	res := resolveString(t, input, Context{HostArg: "web", LocalUser: "local"})
+	got := testSettings{Untouched: "keep", Plain: "plain"}
+	if err := res.Unmarshal(&got); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	want := testSettings{
+		testKeepalive: testKeepalive{Interval: time.Minute, CountMax: 4},
+		Timeout:       10 * time.Second,
+		Port:          2022,
+		Batch:         true,
+		Keys:          []string{"/k/a", "/k/b"},
+		Level:         2,
+		Levels:        []testLogLevel{2},
+		User:          "local",
+		Untouched:     "keep",
+		Plain:         "plain",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestResultUnmarshalErrors(t *testing.T) {
+	res := resolveString(t, "Host *\n  ServerAliveCountMax 300\n  LogLevel loud\n", Context{HostArg: "web", LocalUser: "local"})
+	var typo struct {
+		Timeout time.Duration `ssh:"ConectTimeout"`
+	}
+	var badType struct {
+		Port float64 `ssh:"Port"`
+	}
+	var overflow testKeepalive
+	var level struct {
+		Level testLogLevel `ssh:"LogLevel"`
+	}
+	tests := []struct {
+		v    any
+		want string
+	}{
+		{&typo, `field Timeout: unknown directive "ConectTimeout"`},
+		{&badType, "field Port: unsupported type float64"},
+		{&overflow, "ServerAliveCountMax: 300 overflows uint8"},
+		{&level, `LogLevel: unknown level "loud"`},
+		{typo, "needs a non-nil pointer to a struct"},
+		{(*testSettings)(nil), "needs a non-nil pointer to a struct"},
+	}
+	for _, tt := range tests {
+		err := res.Unmarshal(tt.v)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Unmarshal(%T) got error %v, want %q", tt.v, err, tt.want)
+		}
+	}
+}
@@ -1,6 +1,10 @@
 package ssh_config
 
 import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
 	"strings"
 )
 
@@ -56,3 +60,199 @@ func supportedDirective(keyword string) *specDirective {
 	}
 	return d
 }
+
+// checkArgCount checks the number of arguments of a known directive, given
+// its value as written, against the counts in the spec. Like ssh, it rejects
+// extra arguments with "garbage at end of line". Unknown directives are left
+// to the caller.
+func checkArgCount(spec *clientSpec, key, value string) error {
+	d := spec.byName[strings.ToLower(key)]
+	if d == nil || d.Status == "unsupported" || commandDirectives[strings.ToLower(d.Canonical)] {
+		return nil
+	}
+	args, err := argvSplit(value)
+	if err != nil {
+		return err
+	}
+	if len(args) < d.MinArgs {
+		return errors.New("missing argument")
+	}
+	if d.MaxArgs >= 0 && len(args) > d.MaxArgs {
+		return errors.New("garbage at end of line")
+	}
+	return nil
+}
+
+// Validate checks every directive in c and its included files the way strict
+// Resolve does, whether or not its Host or Match block would match: unknown,
+// unsupported and deprecated directives, the number of arguments and the
+// value. Unknown directives matched by an IgnoreUnknown anywhere before them
+// are allowed. Included files whose reading was deferred are read, and the
+// errors found in them reported too. It returns a ParseErrors with the
+// position of each offending line, or nil.
+func (c *Config) Validate() error {
+	spec, err := loadClientSpec()
+	if err != nil {
+		return err
+	}
+	v := validator{spec: spec}
+	v.config(c)
+	if len(v.errs) == 0 {
+		return nil
+	}
+	return v.errs
+}
+
+type validator struct {
+	spec          *clientSpec
+	ignoreUnknown string
+	errs          ParseErrors
+}
+
+func (v *validator) config(c *Config) {
+	for _, block := range c.effectiveBlocks() {
+		switch b := block.(type) {
+		case *Host:
+			v.nodes(c.filename, b.Nodes)
+		case *Match:
+			v.nodes(c.filename, b.Nodes)
+		}
+	}
+}
+
+func (v *validator) nodes(filename string, nodes []Node) {
+	for _, node := range nodes {
+		switch n := node.(type) {
+		case *KV:
+			if err := v.directive(n.Key, n.Value); err != nil {
+				v.errs = append(v.errs, &ParseError{
+					Filename: filename,
+					Position: n.position,
+					Kind:     KindBadDirective,
+					Err:      fmt.Errorf("%s: %w", n.Key, err),
+				})
+			}
+		case *Include:
+			v.errs = append(v.errs, n.load()...)
+			for _, path := range n.matches {
+				if cfg := n.files[path]; cfg != nil {
+					v.config(cfg)
+				}
+			}
+		}
+	}
+}
+
+func (v *validator) directive(key, raw string) error {
+	lkey := strings.ToLower(key)
+	d := v.spec.byName[lkey]
+	switch {
+	case d == nil:
+		if matchesIgnoreUnknown(v.ignoreUnknown, lkey) {
+			return nil
+		}
+		return errors.New("unknown directive")
+	case d.Status == "unsupported":
+		return errors.New("unsupported directive")
+	case d.Status == "deprecated" && d.AliasFor == "":
+		return errors.New("deprecated directive")
+	}
+	if err := checkArgCount(v.spec, key, raw); err != nil {
+		return err
+	}
+	value, err := directiveValue(v.spec, key, raw)
+	if err != nil {
+		return err
+	}
+	if lkey == "ignoreunknown" && v.ignoreUnknown == "" {
+		v.ignoreUnknown = value
+	}
+	return validateValue(d, value)
+}
+
+// inEnum reports whether val is one of the keywords d accepts.
+func (d *specDirective) inEnum(val string) bool {
+	for _, entry := range d.Enum {
+		if strings.EqualFold(entry, val) {
+			return true
+		}
+	}
+	return false
+}
+
+// validPort reports whether s is a port number from 1 to 65535.
+func validPort(s string) bool {
+	n, err := strconv.ParseUint(s, 10, 16)
+	return err == nil && n > 0
+}
+
+// validateRekeyLimit checks a RekeyLimit value: default or a number of bytes
+// with an optional K, M, G, T, P or E suffix, optionally followed by none or
+// a time.
+func validateRekeyLimit(val string) error {
+	args := splitArgs(val)
+	if len(args) == 0 {
+		return errors.New("missing size")
+	}
+	if !strings.EqualFold(args[0], "default") {
+		n, err := parseScaled(args[0])
+		if err != nil {
+			return err
+		}
+		if n != 0 && n < 16 {
+			return fmt.Errorf("size %q is too small", args[0])
+		}
+	}
+	if len(args) > 1 && !strings.EqualFold(args[1], "none") {
+		if _, err := parseSSHDuration(args[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseScaled parses a size like OpenSSH's scan_scaled: a number with an
+// optional K, M, G, T, P or E suffix for powers of 1024. A fraction, such
+// as 1.5G, needs a suffix.
+func parseScaled(s string) (float64, error) {
+	num, scale := s, 1.0
+	if s != "" {
+		if i := strings.IndexByte("KMGTPE", s[len(s)-1]&^0x20); i >= 0 {
+			num, scale = s[:len(s)-1], math.Pow(1024, float64(i+1))
+		}
+	}
+	if num == "" || strings.Trim(num, "0123456789.") != "" || (scale == 1 && strings.Contains(num, ".")) {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n * scale, nil
+}
+
+// validateEnumPath checks a value that is either one of the keywords of d or
+// a path, such as IdentityAgent. Like ssh, a path that is a $VAR reference
+// must name a valid environment variable.
+func validateEnumPath(d *specDirective, val string) error {
+	if d.inEnum(val) || !strings.HasPrefix(val, "$") || strings.HasPrefix(val, "${") {
+		return nil
+	}
+	if !validEnvName(val[1:]) {
+		return fmt.Errorf("invalid environment variable name %q", val[1:])
+	}
+	return nil
+}
+
+func validEnvName(name string) bool {
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c != '_' && (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
+}
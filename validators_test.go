@@ -1,6 +1,12 @@
 package ssh_config
 
-import "testing"
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
 
 func TestDefault(t *testing.T) {
 	if v := Default("Port"); v != "22" {
@@ -28,3 +34,144 @@ func TestSupportsMultiple(t *testing.T) {
 		t.Errorf("SupportsMultiple(%q): got true, want false", "notfound")
 	}
 }
+
+func TestResolveArgCount(t *testing.T) {
+	tests := []struct {
+		line string
+		err  string
+	}{
+		{"Port 22 23", "garbage at end of line"},
+		{"Compression yes please", "garbage at end of line"},
+		{"IdentityFile a b", "garbage at end of line"},
+		{"IPQoS af21 cs1 cs2", "garbage at end of line"},
+		{"LocalForward 8080", "missing argument"},
+		{`IdentityFile "a b"`, ""},
+		{"IPQoS af21 cs1", ""},
+		{"LocalForward 8080 localhost:80", ""},
+		{"RemoteForward 8080", ""},
+		{"SendEnv LANG LC_*", ""},
+		{"ProxyCommand nc %h %p", ""},
+	}
+	for _, tt := range tests {
+		cfg, err := Decode(strings.NewReader("Host *\n  " + tt.line + "\n"))
+		if err != nil {
+			t.Fatalf("Decode: %v", err)
+		}
+		_, err = cfg.Resolve(Context{HostArg: "example"}, Strict())
+		if tt.err == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", tt.line, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), "<config>:2:3") || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: got error %v, want %q at <config>:2:3", tt.line, err, tt.err)
+		}
+		if _, err := cfg.Resolve(Context{HostArg: "example"}); err != nil {
+			t.Errorf("%s: non-strict Resolve: %v", tt.line, err)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	dir := t.TempDir()
+	inner := filepath.Join(dir, "inner")
+	if err := os.WriteFile(inner, []byte("Port 22 23\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Decode(strings.NewReader(`IgnoreUnknown Use*
+Host never
+  Compression yes please
+  UseKeychain yes
+Match all
+  Bogus x
+  BatchMode maybe
+Include ` + inner + `
+`))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	err = cfg.Validate()
+	var perrs ParseErrors
+	if !errors.As(err, &perrs) {
+		t.Fatalf("expected ParseErrors, got %#v", err)
+	}
+	want := []struct {
+		filename string
+		pos      Position
+		msg      string
+	}{
+		{"", Position{3, 3}, "garbage at end of line"},
+		{"", Position{6, 3}, "unknown directive"},
+		{"", Position{7, 3}, "must be yes or no"},
+		{inner, Position{1, 1}, "garbage at end of line"},
+	}
+	if len(perrs) != len(want) {
+		t.Fatalf("got %d errors, want %d: %v", len(perrs), len(want), perrs.Unwrap())
+	}
+	for i, w := range want {
+		perr := perrs[i]
+		if perr.Filename != w.filename || perr.Position != w.pos || perr.Kind != KindBadDirective || !strings.Contains(perr.Error(), w.msg) {
+			t.Errorf("error %d: got %v (%s at %v), want %q in %q at %v", i, perr, perr.Filename, perr.Position, w.msg, w.filename, w.pos)
+		}
+	}
+
+	cfg, err = Decode(strings.NewReader("Host *\n  Port 22\n  SendEnv A B\n"))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate: %v", err)
+	}
+}
+
+func TestResolveStrictValueGrammars(t *testing.T) {
+	tests := []struct {
+		line string
+		ok   bool
+	}{
+		{"ConnectTimeout 1m30s", true},
+		{"ConnectTimeout 5x", false},
+		{"ServerAliveInterval 15", true},
+		{"ServerAliveCountMax -1", false},
+		{"ControlPersist yes", true},
+		{"ControlPersist 10m", true},
+		{"ControlPersist maybe", false},
+		{"Port 2222", true},
+		{"Port 0", false},
+		{"Port 70000", false},
+		{"LocalForward [::1]:8080 localhost:80", true},
+		{"LocalForward /tmp/local.sock /run/remote.sock", true},
+		{"LocalForward abc localhost:80", false},
+		{"LocalForward 8080 localhost:http", false},
+		{"RemoteForward 8080", true},
+		{"DynamicForward localhost:1080", true},
+		{"DynamicForward [::1:1080", false},
+		{"RekeyLimit 1G 1h", true},
+		{"RekeyLimit 1.5G", true},
+		{"RekeyLimit default none", true},
+		{"RekeyLimit 1Q", false},
+		{"RekeyLimit 8", false},
+		{"RekeyLimit 1G forever", false},
+		{"IdentityAgent SSH_AUTH_SOCK", true},
+		{"IdentityAgent none", true},
+		{"IdentityAgent $MY_AGENT", true},
+		{"IdentityAgent ${HOME}/agent.sock", true},
+		{"IdentityAgent ~/agent.sock", true},
+		{"IdentityAgent $1AGENT", false},
+		{"ForwardAgent $SSH_AUTH_SOCK", true},
+	}
+	for _, tt := range tests {
+		cfg, err := Decode(strings.NewReader("Host *\n  " + tt.line + "\n"))
+		if err != nil {
+			t.Fatalf("Decode: %v", err)
+		}
+		_, err = cfg.Resolve(Context{HostArg: "example"}, Strict())
+		if tt.ok && err != nil {
+			t.Errorf("%s: unexpected error %v", tt.line, err)
+		}
+		if !tt.ok && err == nil {
+			t.Errorf("%s: expected an error", tt.line)
+		}
+	}
+}